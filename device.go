@@ -0,0 +1,67 @@
+package labjack
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotSupported is returned for operations a device does not support.
+var ErrNotSupported = errors.New("Operation not supported by device")
+
+// DeviceInfo describes a LabJack device.
+type DeviceInfo struct {
+
+	// Model is the device model, such as "U6" or "U6-Pro".
+	Model           string
+	SerialNumber    int
+	FirmwareVersion string
+	HardwareVersion string
+}
+
+// StreamConfig configures a stream of analog or digital channels.
+type StreamConfig struct {
+
+	// Channels are the channels read in every scan, in order. The channel
+	// numbers are those of the device.
+	Channels []int
+
+	// ScanRate is the number of scans per second.
+	ScanRate int
+}
+
+// Scan holds a value of every channel of a stream. Analog channels are read
+// in volts. Err is set when the stream reported an error instead.
+type Scan struct {
+	Time   time.Time
+	Number int
+	Values []float64
+	Err    error
+}
+
+// Device is a LabJack device. It lets applications accept any LabJack model
+// or a simulated device.
+type Device interface {
+
+	// Describe returns the device details.
+	Describe() DeviceInfo
+
+	// ReadAnalog reads an analog input in volts.
+	ReadAnalog(ctx context.Context, channel int) (float64, error)
+
+	// WriteAnalog sets an analog output in volts.
+	WriteAnalog(ctx context.Context, channel int, volts float64) error
+
+	// ReadDigital reads a digital line without changing its direction.
+	ReadDigital(ctx context.Context, line int) (bool, error)
+
+	// WriteDigital configures a digital line as output and sets it.
+	WriteDigital(ctx context.Context, line int, state bool) error
+
+	// StartStream starts a stream. The stream runs until the context is done,
+	// after which the channel is closed.
+	StartStream(ctx context.Context, config StreamConfig) (<-chan Scan, error)
+
+	// Close closes the device.
+	Close() error
+}
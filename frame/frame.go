@@ -0,0 +1,190 @@
+/*
+Package frame builds and validates the packets of the LabJack USB protocol.
+
+Normal commands carry an 8-bit checksum of the whole packet in byte 0. Extended
+commands have 0xF8 in byte 1, the number of data words in byte 2 and the
+extended command number in byte 3; byte 0 holds the 8-bit checksum of bytes 1
+to 5 and bytes 4 and 5 the 16-bit checksum of the data.
+*/
+package frame
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+
+	// ExtendedCommand is the command byte of extended commands and responses.
+	ExtendedCommand byte = 0xF8
+
+	// StreamDataCommand is the command byte of stream data packets.
+	StreamDataCommand byte = 0xF9
+
+	// StreamDataNumber is the extended command number of stream data packets.
+	StreamDataNumber byte = 0xC0
+
+	// BadChecksum is echoed in bytes 0 and 1 when the device receives a
+	// command with a bad checksum.
+	BadChecksum byte = 0xB8
+
+	// HeaderSize is the size of the extended header.
+	HeaderSize = 6
+)
+
+// ErrTooShort is returned if a packet is too short to be validated.
+var ErrTooShort = errors.New("Response data is too short")
+
+// ErrChecksumEcho is returned if the device reports that the command had a bad checksum.
+var ErrChecksumEcho = errors.New("The device detected a bad checksum. Double check your checksum calculations and try again")
+
+// ErrChecksum is returned if the checksum of a response is invalid.
+var ErrChecksum = errors.New("Invalid checksum")
+
+// ErrHeader is returned if the response header is not valid.
+var ErrHeader = errors.New("Invalid response header")
+
+// ErrTooLong is returned if the data of an extended command exceeds 255 words.
+var ErrTooLong = errors.New("Command data is too long")
+
+// ErrorCode is the non-zero error code reported in a response.
+type ErrorCode byte
+
+func (e ErrorCode) Error() string {
+	return fmt.Sprintf("LabJack error code: %d", byte(e))
+}
+
+// Checksum8 returns the 8-bit checksum of p: the sum of the bytes with the
+// carry folded back twice.
+func Checksum8(p []byte) byte {
+	var total int
+	for _, b := range p {
+		total += int(b)
+	}
+	total = total&0xFF + total>>8
+	total = total&0xFF + total>>8
+	return byte(total)
+}
+
+// Checksum16 returns the 16-bit checksum of p: the sum of the bytes.
+func Checksum16(p []byte) uint16 {
+	var total uint16
+	for _, b := range p {
+		total += uint16(b)
+	}
+	return total
+}
+
+// Normal builds a normal command.
+func Normal(command byte, data ...byte) []byte {
+	p := make([]byte, 2+len(data))
+	p[1] = command
+	copy(p[2:], data)
+	p[0] = Checksum8(p[1:])
+	return p
+}
+
+// Extended builds an extended command. Odd data is padded with a zero byte.
+func Extended(command byte, data []byte) ([]byte, error) {
+	size := len(data) + len(data)%2
+	if size/2 > 255 {
+		return nil, ErrTooLong
+	}
+
+	p := make([]byte, HeaderSize+size)
+	p[1] = ExtendedCommand
+	p[2] = byte(size / 2)
+	p[3] = command
+	copy(p[HeaderSize:], data)
+	SetExtendedChecksum(p)
+	return p, nil
+}
+
+// SetExtendedChecksum sets the checksums of an extended packet.
+func SetExtendedChecksum(p []byte) {
+	c16 := Checksum16(p[HeaderSize:])
+	p[4] = byte(c16)
+	p[5] = byte(c16 >> 8)
+	p[0] = Checksum8(p[1:HeaderSize])
+}
+
+// Response is a validated response.
+type Response struct {
+
+	// Command is the command byte of a normal response or the extended
+	// command number of an extended response.
+	Command byte
+
+	// Words is the number of data words of an extended response.
+	Words int
+
+	// ErrorCode is the error code reported by the device.
+	ErrorCode byte
+
+	// Data holds the bytes following the header: from byte 2 of a normal
+	// response and from byte 6 of an extended response.
+	Data []byte
+}
+
+// ParseNormal validates a normal response with the given command byte. The
+// error code is read from byte 2. An ErrorCode is returned with the response
+// if it is not zero.
+func ParseNormal(p []byte, command byte) (Response, error) {
+	if len(p) >= 2 && p[0] == BadChecksum && p[1] == BadChecksum {
+		return Response{}, ErrChecksumEcho
+	} else if len(p) < 3 {
+		return Response{}, ErrTooShort
+	} else if Checksum8(p[1:]) != p[0] {
+		return Response{}, ErrChecksum
+	} else if p[1] != command {
+		return Response{}, ErrHeader
+	}
+
+	resp := Response{Command: p[1], ErrorCode: p[2], Data: p[2:]}
+	if resp.ErrorCode != 0 {
+		return resp, ErrorCode(resp.ErrorCode)
+	}
+	return resp, nil
+}
+
+// ParseExtended validates an extended response with the given command
+// number. The error code is read from byte 6. An ErrorCode is returned with
+// the response if it is not zero.
+func ParseExtended(p []byte, command byte) (Response, error) {
+	resp, err := parseExtended(p, ExtendedCommand, command)
+	if err != nil {
+		return resp, err
+	} else if len(p) <= HeaderSize {
+		return Response{}, ErrTooShort
+	}
+
+	resp.ErrorCode = p[HeaderSize]
+	if resp.ErrorCode != 0 {
+		return resp, ErrorCode(resp.ErrorCode)
+	}
+	return resp, nil
+}
+
+// ParseStream validates a stream data packet. Stream packets report their
+// error code in byte 11, which is left to the caller.
+func ParseStream(p []byte) (Response, error) {
+	return parseExtended(p, StreamDataCommand, StreamDataNumber)
+}
+
+func parseExtended(p []byte, kind, command byte) (Response, error) {
+	if len(p) >= 2 && p[0] == BadChecksum && p[1] == BadChecksum {
+		return Response{}, ErrChecksumEcho
+	} else if len(p) < HeaderSize {
+		return Response{}, ErrTooShort
+	}
+
+	c16 := Checksum16(p[HeaderSize:])
+	if byte(c16) != p[4] || byte(c16>>8) != p[5] || Checksum8(p[1:HeaderSize]) != p[0] {
+		return Response{}, ErrChecksum
+	} else if p[1] != kind || p[3] != command {
+		return Response{}, ErrHeader
+	} else if int(p[2]) != (len(p)-HeaderSize+1)/2 {
+		return Response{}, ErrHeader
+	}
+	return Response{Command: p[3], Words: int(p[2]), Data: p[HeaderSize:]}, nil
+}
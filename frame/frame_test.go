@@ -0,0 +1,185 @@
+package frame
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestNormal(t *testing.T) {
+	if p := Normal(0xA8); !bytes.Equal(p, []byte{0xA8, 0xA8}) {
+		t.Fatalf("Invalid StreamStart command: % x", p)
+	}
+}
+
+func TestExtended(t *testing.T) {
+
+	// StreamConfig for one channel
+	p, err := Extended(0x11, []byte{1, 1, 25, 0, 1, 0, 32, 3, 193, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []byte{16, 248, 5, 17, 0, 1, 1, 1, 25, 0, 1, 0, 32, 3, 193, 0}
+	if !bytes.Equal(p, expected) {
+		t.Fatalf("Invalid command: %v != %v", p, expected)
+	}
+
+	// Odd data is padded
+	p, err = Extended(0x00, []byte{0, 10, 2})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(p) != 10 || p[2] != 2 {
+		t.Fatalf("Invalid padding: %v", p)
+	}
+
+	if _, err := Extended(0x00, make([]byte, 512)); err != ErrTooLong {
+		t.Fatalf("Expected ErrTooLong; got %v", err)
+	}
+}
+
+func TestChecksum8Carry(t *testing.T) {
+	// 0xFF + 0xFF + 0x01 = 0x1FF folds to 0x100 and then to 0x01
+	if c := Checksum8([]byte{0xFF, 0xFF, 0x01}); c != 0x01 {
+		t.Fatalf("Invalid checksum: %d", c)
+	}
+}
+
+func TestParseExtended(t *testing.T) {
+	valid, _ := Extended(0x11, []byte{0, 0})
+
+	resp, err := ParseExtended(valid, 0x11)
+	if err != nil {
+		t.Fatal(err)
+	} else if resp.Command != 0x11 || resp.Words != 1 || len(resp.Data) != 2 {
+		t.Fatalf("Invalid response: %+v", resp)
+	}
+
+	failed, _ := Extended(0x11, []byte{48, 0})
+	resp, err = ParseExtended(failed, 0x11)
+	if code := ErrorCode(0); !errors.As(err, &code) || code != 48 {
+		t.Fatalf("Expected error code 48; got %v", err)
+	} else if resp.ErrorCode != 48 {
+		t.Fatalf("Invalid error code: %d", resp.ErrorCode)
+	}
+
+	corrupt := append([]byte(nil), valid...)
+	corrupt[7] ^= 1
+
+	short, _ := Extended(0x11, nil)
+	tests := []struct {
+		name     string
+		packet   []byte
+		command  byte
+		expected error
+	}{
+		{"echo", []byte{0xB8, 0xB8}, 0x11, ErrChecksumEcho},
+		{"short", valid[:4], 0x11, ErrTooShort},
+		{"header only", short, 0x11, ErrTooShort},
+		{"checksum", corrupt, 0x11, ErrChecksum},
+		{"command", valid, 0x08, ErrHeader},
+		{"words", append(append([]byte(nil), valid...), 0, 0), 0x11, ErrHeader},
+	}
+	for _, test := range tests {
+		if _, err := ParseExtended(test.packet, test.command); err != test.expected {
+			t.Errorf("%s: expected %v; got %v", test.name, test.expected, err)
+		}
+	}
+}
+
+func TestParseNormal(t *testing.T) {
+	if _, err := ParseNormal(Normal(0xA9, 0, 0), 0xA9); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ParseNormal(Normal(0xB1, 52, 0), 0xB1); err != ErrorCode(52) {
+		t.Fatalf("Expected error code 52; got %v", err)
+	} else if _, err := ParseNormal(Normal(0xA9, 0, 0), 0xB1); err != ErrHeader {
+		t.Fatalf("Expected ErrHeader; got %v", err)
+	} else if _, err := ParseNormal([]byte{0xB8, 0xB8}, 0xA9); err != ErrChecksumEcho {
+		t.Fatalf("Expected ErrChecksumEcho; got %v", err)
+	} else if _, err := ParseNormal([]byte{0, 0xA9, 0, 0}, 0xA9); err != ErrChecksum {
+		t.Fatalf("Expected ErrChecksum; got %v", err)
+	}
+}
+
+func TestParseStream(t *testing.T) {
+	packet := make([]byte, 16)
+	packet[1] = StreamDataCommand
+	packet[2] = 5
+	packet[3] = StreamDataNumber
+	packet[12] = 0x34
+	packet[13] = 0x12
+	SetExtendedChecksum(packet)
+
+	resp, err := ParseStream(packet)
+	if err != nil {
+		t.Fatal(err)
+	} else if resp.Words != 5 || resp.Data[6] != 0x34 {
+		t.Fatalf("Invalid response: %+v", resp)
+	}
+
+	packet[2] = 6
+	SetExtendedChecksum(packet)
+	if _, err := ParseStream(packet); err != ErrHeader {
+		t.Fatalf("Expected ErrHeader; got %v", err)
+	}
+}
+
+func FuzzParseExtended(f *testing.F) {
+	valid, _ := Extended(0x11, []byte{0, 0})
+	f.Add(valid, byte(0x11))
+	f.Add([]byte{0xB8, 0xB8}, byte(0x00))
+	f.Fuzz(func(t *testing.T, p []byte, command byte) {
+		resp, err := ParseExtended(p, command)
+		if err == nil && (len(resp.Data) != len(p)-HeaderSize || resp.Data[0] != 0) {
+			t.Fatalf("Invalid response: %+v", resp)
+		}
+	})
+}
+
+func FuzzParseNormal(f *testing.F) {
+	f.Add(Normal(0xA9, 0, 0), byte(0xA9))
+	f.Add([]byte{0xB8, 0xB8}, byte(0xA9))
+	f.Fuzz(func(t *testing.T, p []byte, command byte) {
+		resp, err := ParseNormal(p, command)
+		if err == nil && (resp.Command != command || resp.ErrorCode != 0) {
+			t.Fatalf("Invalid response: %+v", resp)
+		}
+	})
+}
+
+func FuzzParseStream(f *testing.F) {
+	packet := make([]byte, 16)
+	packet[1] = StreamDataCommand
+	packet[2] = 5
+	packet[3] = StreamDataNumber
+	SetExtendedChecksum(packet)
+	f.Add(packet)
+	f.Add(packet[:6])
+	f.Fuzz(func(t *testing.T, p []byte) {
+		resp, err := ParseStream(p)
+		if err == nil && len(resp.Data) != len(p)-HeaderSize {
+			t.Fatalf("Invalid response: %+v", resp)
+		}
+	})
+}
+
+func FuzzExtended(f *testing.F) {
+	f.Add(byte(0x00), []byte{0, 10, 2})
+	f.Fuzz(func(t *testing.T, command byte, data []byte) {
+		p, err := Extended(command, data)
+		if err != nil {
+			return
+		}
+
+		resp, err := ParseExtended(p, command)
+		if len(data) == 0 || data[0] != 0 {
+			return
+		} else if err != nil {
+			t.Fatalf("Command does not parse: %v", err)
+		} else if !bytes.Equal(resp.Data[:len(data)], data) {
+			t.Fatalf("Data does not match: %v != %v", resp.Data, data)
+		}
+	})
+}
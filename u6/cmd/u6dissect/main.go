@@ -0,0 +1,166 @@
+// Command u6dissect decodes U6 packets from hex dumps, usbmon captures and
+// recordings.
+//
+// Usage:
+//
+//	u6dissect [file ...]
+//
+// The files, or stdin, hold one packet per line in one of the formats:
+//
+//	2f f8 02 00 34 00 2a 0a 00 00                       hex bytes
+//	> 2ff8020034002a0a0000                              hex with a direction, > or <
+//	... S Bo:1:005:1 -115 10 = 2ff80200 34002a0a 0000   usbmon text
+//	{"pipe":"EP1","data":"2ff8020034002a0a0000"}        u6.Recorder output
+//
+// Packets without a direction are taken as alternating commands and
+// responses, except stream data which is always read from the U6. Lines
+// starting with # are ignored.
+//
+// Binary pcap captures of usbmon, as written by tcpdump -i usbmon1 -w or
+// Wireshark, are read as well. pcapng captures must first be converted with
+// editcap -F pcap.
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/eliquious/labjack/u6"
+)
+
+func main() {
+	flag.Parse()
+
+	d := &dissector{Dissector: u6.NewDissector(), out: os.Stdout}
+	if flag.NArg() == 0 {
+		if err := d.dissect(os.Stdin); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	for _, name := range flag.Args() {
+		f, err := os.Open(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = d.dissect(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("%s: %v", name, err)
+		}
+	}
+}
+
+type dissector struct {
+	*u6.Dissector
+	out io.Writer
+
+	// response is set when the next packet without a direction is a response.
+	response bool
+}
+
+func (d *dissector) dissect(r io.Reader) error {
+	br := bufio.NewReader(r)
+	header, _ := br.Peek(4)
+	if _, ok := isPcap(header); ok {
+		return d.dissectPcap(br)
+	} else if isPcapng(header) {
+		return errPcapng
+	}
+
+	scanner := bufio.NewScanner(br)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var line int
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		dir, p, ok, err := parseLine(text)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		} else if len(p) == 0 {
+			continue
+		} else if !ok {
+			dir = d.guessDirection(p)
+		}
+
+		for _, packet := range d.Dissect(dir, p) {
+			fmt.Fprintln(d.out, packet)
+		}
+		d.response = dir == u6.DirectionOut
+	}
+	return scanner.Err()
+}
+
+// guessDirection guesses the direction of a packet from the preceding packet.
+func (d *dissector) guessDirection(p []byte) u6.Direction {
+	if d.response || u6.CommandName(p) == "StreamData" {
+		return u6.DirectionIn
+	}
+	return u6.DirectionOut
+}
+
+// parseLine parses a packet. ok reports whether the line gave the direction.
+func parseLine(text string) (dir u6.Direction, p []byte, ok bool, err error) {
+	switch {
+	case strings.HasPrefix(text, "{"):
+		var packet u6.Packet
+		if err := json.Unmarshal([]byte(text), &packet); err != nil {
+			return dir, nil, false, err
+		}
+		if packet.Pipe == u6.PipeCommand {
+			return u6.DirectionOut, packet.Data, true, nil
+		}
+		return u6.DirectionIn, packet.Data, true, nil
+
+	case strings.HasPrefix(text, ">"):
+		p, err = parseHex(text[1:])
+		return u6.DirectionOut, p, true, err
+
+	case strings.HasPrefix(text, "<"):
+		p, err = parseHex(text[1:])
+		return u6.DirectionIn, p, true, err
+
+	case strings.Contains(text, " = "):
+		return parseUsbmon(text)
+	}
+
+	p, err = parseHex(text)
+	return dir, p, false, err
+}
+
+// parseUsbmon parses a line of the usbmon text interface. Only submissions
+// of OUT transfers and completions of IN transfers carry data.
+func parseUsbmon(text string) (u6.Direction, []byte, bool, error) {
+	fields := strings.Fields(text)
+	i := strings.Index(text, " = ")
+	if len(fields) < 4 || i < 0 {
+		return u6.DirectionOut, nil, false, fmt.Errorf("invalid usbmon line")
+	}
+
+	dir := u6.DirectionOut
+	if strings.HasPrefix(fields[3], "Bi") || strings.HasPrefix(fields[3], "Ii") {
+		dir = u6.DirectionIn
+	}
+
+	p, err := parseHex(text[i+3:])
+	return dir, p, true, err
+}
+
+func parseHex(text string) ([]byte, error) {
+	text = strings.Join(strings.Fields(text), "")
+	text = strings.ReplaceAll(text, ":", "")
+	return hex.DecodeString(text)
+}
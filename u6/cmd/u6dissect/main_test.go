@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/eliquious/labjack/u6"
+)
+
+const (
+	feedbackCommand  = "2ff8020034002a0a0000"
+	feedbackResponse = "26f802002b0000002a01"
+)
+
+func Test_ParseLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		dir  u6.Direction
+		ok   bool
+		data string
+		err  bool
+	}{
+		{"hex", "2f f8 02 00 34 00 2a 0a 00 00", u6.DirectionOut, false, feedbackCommand, false},
+		{"hex with colons", "2f:f8:02:00:34:00:2a:0a:00:00", u6.DirectionOut, false, feedbackCommand, false},
+		{"command", "> " + feedbackCommand, u6.DirectionOut, true, feedbackCommand, false},
+		{"response", "<" + feedbackResponse, u6.DirectionIn, true, feedbackResponse, false},
+		{"usbmon out", "ffff8801 3575914555 S Bo:1:005:1 -115 10 = 2ff80200 34002a0a 0000", u6.DirectionOut, true, feedbackCommand, false},
+		{"usbmon in", "ffff8801 3575915067 C Bi:1:005:2 0 10 = 26f80200 2b000000 2a01", u6.DirectionIn, true, feedbackResponse, false},
+		{"usbmon interrupt in", "ffff8801 3575915067 C Ii:1:005:2 0 2 = 2a01", u6.DirectionIn, true, "2a01", false},
+		{"recorder command", `{"pipe":"EP1","data":"` + feedbackCommand + `"}`, u6.DirectionOut, true, feedbackCommand, false},
+		{"recorder response", `{"pipe":"EP2","data":"` + feedbackResponse + `"}`, u6.DirectionIn, true, feedbackResponse, false},
+		{"recorder stream", `{"pipe":"EP3","data":"00"}`, u6.DirectionIn, true, "00", false},
+		{"invalid hex", "2f f8 0", u6.DirectionOut, false, "", true},
+		{"invalid usbmon hex", "ffff8801 3575914555 S Bo:1:005:1 -115 1 = zz", u6.DirectionOut, true, "", true},
+		{"invalid json", `{"pipe":`, u6.DirectionOut, false, "", true},
+	}
+
+	for _, test := range tests {
+		dir, p, ok, err := parseLine(test.line)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected error", test.name)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if ok != test.ok || ok && dir != test.dir || hex.EncodeToString(p) != test.data {
+			t.Errorf("%s: got %v %v %x", test.name, dir, ok, p)
+		}
+	}
+}
+
+func Test_ParseUsbmon(t *testing.T) {
+	for _, line := range []string{
+		"ffff8801 3575914555 S Bo:1:005:1 -115 10",
+		"Bo:1:005:1 = 2ff8",
+		"",
+	} {
+		if _, _, _, err := parseUsbmon(line); err == nil {
+			t.Errorf("Expected error for %q", line)
+		}
+	}
+}
+
+func Test_DissectText(t *testing.T) {
+	var out bytes.Buffer
+	d := &dissector{Dissector: u6.NewDissector(), out: &out}
+	input := "# capture\n" + feedbackCommand + "\n\n" + feedbackResponse + "\n"
+	if err := d.dissect(strings.NewReader(input)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The response direction is taken from the preceding command
+	if !strings.Contains(out.String(), "out Feedback") || !strings.Contains(out.String(), "FIO0 = 1") {
+		t.Fatalf("Invalid output:\n%s", out.String())
+	}
+}
+
+// testdata/feedback.pcap is a hand-built usbmon capture (link type 220, little
+// endian) of the feedbackCommand submission and the feedbackResponse
+// completion, with the empty OUT completion and IN submission in between.
+func readFixture(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/feedback.pcap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// bigEndian rewrites the pcap headers of a little endian capture in big
+// endian. The usbmon headers are left in the byte order of the capturing host.
+func bigEndian(data []byte) []byte {
+	out := append([]byte(nil), data...)
+	swap := func(p []byte, sizes ...int) {
+		for _, size := range sizes {
+			for i, j := 0, size-1; i < j; i, j = i+1, j-1 {
+				p[i], p[j] = p[j], p[i]
+			}
+			p = p[size:]
+		}
+	}
+	swap(out, 4, 2, 2, 4, 4, 4, 4)
+	for p := out[24:]; len(p) >= 16; {
+		size := int(binary.LittleEndian.Uint32(p[8:]))
+		swap(p, 4, 4, 4, 4)
+		p = p[16+size:]
+	}
+	return out
+}
+
+func Test_DissectPcap(t *testing.T) {
+	fixture := readFixture(t)
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"little endian", fixture},
+		{"big endian", bigEndian(fixture)},
+	}
+
+	for _, test := range tests {
+		if _, ok := isPcap(test.data); !ok {
+			t.Fatalf("%s: not detected as pcap", test.name)
+		}
+
+		var out bytes.Buffer
+		d := &dissector{Dissector: u6.NewDissector(), out: &out}
+		if err := d.dissect(bytes.NewReader(test.data)); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		expected := "out Feedback (10 bytes, checksum ok)\n    echo: 0x2a\n    [0] BitStateRead: FIO0\n" +
+			"in  Feedback (10 bytes, checksum ok)\n    echo: 0x2a\n    [0] BitStateRead: FIO0 = 1\n"
+		if out.String() != expected {
+			t.Fatalf("%s: invalid output:\n%s", test.name, out.String())
+		}
+	}
+}
+
+func Test_DissectPcapErrors(t *testing.T) {
+	fixture := readFixture(t)
+
+	linkType := append([]byte(nil), fixture...)
+	binary.LittleEndian.PutUint32(linkType[20:], 1)
+
+	truncated := fixture[:len(fixture)-4]
+
+	pcapng := []byte{0x0A, 0x0D, 0x0D, 0x0A, 0x1C, 0x00, 0x00, 0x00}
+
+	for name, data := range map[string][]byte{
+		"link type": linkType,
+		"truncated": truncated,
+		"pcapng":    pcapng,
+	} {
+		d := &dissector{Dissector: u6.NewDissector(), out: &bytes.Buffer{}}
+		if err := d.dissect(bytes.NewReader(data)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
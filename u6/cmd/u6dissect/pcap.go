@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/eliquious/labjack/u6"
+)
+
+var errPcapng = errors.New("pcapng captures are not supported; convert them with editcap -F pcap")
+
+// Link types of usbmon captures.
+const (
+	linkTypeUSBLinux        = 189
+	linkTypeUSBLinuxMmapped = 220
+)
+
+// Sizes of the usbmon packet headers by link type.
+var usbmonHeaderSizes = map[uint32]int{
+	linkTypeUSBLinux:        48,
+	linkTypeUSBLinuxMmapped: 64,
+}
+
+// maxPcapRecord bounds the size of a capture record.
+const maxPcapRecord = 1 << 20
+
+// isPcap reports whether the header starts a pcap capture, and its byte order.
+func isPcap(header []byte) (binary.ByteOrder, bool) {
+	if len(header) < 4 {
+		return nil, false
+	}
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		switch order.Uint32(header) {
+		case 0xA1B2C3D4, 0xA1B23C4D:
+			return order, true
+		}
+	}
+	return nil, false
+}
+
+// isPcapng reports whether the header starts a pcapng capture.
+func isPcapng(header []byte) bool {
+	return len(header) >= 4 && binary.LittleEndian.Uint32(header) == 0x0A0D0D0A
+}
+
+// dissectPcap dissects a pcap capture of usbmon, as written by tcpdump or
+// Wireshark. Only bulk and interrupt transfers carrying data are decoded.
+func (d *dissector) dissectPcap(r io.Reader) error {
+	header := make([]byte, 24)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return err
+	}
+
+	order, _ := isPcap(header)
+	linkType := order.Uint32(header[20:]) & 0x0FFFFFFF
+	headerSize, ok := usbmonHeaderSizes[linkType]
+	if !ok {
+		return fmt.Errorf("unsupported pcap link type %d; expected a usbmon capture", linkType)
+	}
+
+	record := make([]byte, 16)
+	for n := 1; ; n++ {
+		if _, err := io.ReadFull(r, record); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("record %d: %v", n, err)
+		}
+
+		size := order.Uint32(record[8:])
+		if size > maxPcapRecord {
+			return fmt.Errorf("record %d: invalid size %d", n, size)
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return fmt.Errorf("record %d: %v", n, err)
+		}
+
+		dir, p, ok := parseUsbmonPacket(data, headerSize)
+		if !ok {
+			continue
+		}
+		for _, packet := range d.Dissect(dir, p) {
+			fmt.Fprintln(d.out, packet)
+		}
+		d.response = dir == u6.DirectionOut
+	}
+}
+
+// parseUsbmonPacket parses a binary usbmon packet. Only submissions of OUT
+// transfers and completions of IN transfers carry data. The header is in the
+// byte order of the capturing host, taken as little endian.
+func parseUsbmonPacket(data []byte, headerSize int) (u6.Direction, []byte, bool) {
+	if len(data) < headerSize {
+		return u6.DirectionOut, nil, false
+	}
+
+	event, transfer, endpoint, flagData := data[8], data[9], data[10], data[15]
+	if transfer != 1 && transfer != 3 || flagData != 0 {
+		return u6.DirectionOut, nil, false
+	}
+
+	dir := u6.DirectionOut
+	if endpoint&0x80 != 0 {
+		dir = u6.DirectionIn
+	}
+	if dir == u6.DirectionOut && event != 'S' || dir == u6.DirectionIn && event != 'C' {
+		return dir, nil, false
+	}
+
+	p := data[headerSize:]
+	if captured := int(binary.LittleEndian.Uint32(data[36:])); captured < len(p) {
+		p = p[:captured]
+	}
+	return dir, p, len(p) > 0
+}
@@ -1 +1,80 @@
 package u6
+
+import (
+	"time"
+)
+
+// Option configures how a U6 is opened.
+type Option func(*options)
+
+type options struct {
+	skipReset   bool
+	calibration *CalibrationInfo
+	policy      RetryPolicy
+	logger      Logger
+	serial      int
+	readOnly    bool
+}
+
+func newOptions(opts []Option) options {
+	o := options{policy: DefaultRetryPolicy}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithoutReset skips the USB reset when opening the device, so that a running
+// stream or the output state is not disturbed.
+func WithoutReset() Option {
+	return func(o *options) {
+		o.skipReset = true
+	}
+}
+
+// WithCalibration uses the calibration instead of reading it from the device.
+func WithCalibration(cal CalibrationInfo) Option {
+	return func(o *options) {
+		o.calibration = &cal
+	}
+}
+
+// WithTimeouts sets the write and read timeouts of command transactions.
+func WithTimeouts(write, read time.Duration) Option {
+	return func(o *options) {
+		o.policy.WriteTimeout = write
+		o.policy.ReadTimeout = read
+	}
+}
+
+// WithRetryPolicy sets the retry policy of command transactions.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(o *options) {
+		o.policy = policy
+	}
+}
+
+// WithLogger sets the logger, see SetLogger. Opening the device is logged as
+// well, including retries and failures of the initialization commands.
+func WithLogger(logger Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithSerialNumber selects the U6 with the given serial number. Opening fails
+// with ErrDeviceNotFound if the device has another serial number.
+func WithSerialNumber(serial int) Option {
+	return func(o *options) {
+		o.serial = serial
+	}
+}
+
+// WithReadOnly opens the U6 in a safe mode which refuses output commands with
+// ErrReadOnly, so that the device can be monitored without changing its
+// outputs.
+func WithReadOnly() Option {
+	return func(o *options) {
+		o.readOnly = true
+	}
+}
@@ -0,0 +1,77 @@
+package u6_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/eliquious/labjack/u6"
+)
+
+func Test_OpenOptions(t *testing.T) {
+	sim := u6.NewSimulator()
+	cal := u6.DefaultCalibrationInfo
+	cal.CalConstants[22] = -92.379
+
+	logger := &recordingLogger{}
+	dev, err := u6.Open(sim,
+		u6.WithCalibration(cal),
+		u6.WithTimeouts(time.Millisecond*250, time.Millisecond*500),
+		u6.WithLogger(logger),
+		u6.WithSerialNumber(sim.SerialNumber),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dev.Close()
+
+	if dev.GetCalibrationInfo() != cal {
+		t.Fatal("Calibration was not overridden")
+	} else if policy := dev.RetryPolicy(); policy.WriteTimeout != time.Millisecond*250 || policy.ReadTimeout != time.Millisecond*500 {
+		t.Fatalf("Invalid timeouts: %+v", policy)
+	}
+
+	if len(logger.messages) != 1 || logger.messages[0] != "Opened U6" {
+		t.Fatalf("Opening was not logged: %v", logger.messages)
+	}
+
+	sim.CorruptResponses(1)
+	if err := dev.Feedback(&u6.FeedbackBitStateRead{BitNumber: u6.FIO0}); err != nil {
+		t.Fatal(err)
+	} else if len(logger.messages) != 2 {
+		t.Fatalf("Logger was not set: %v", logger.messages)
+	}
+
+	if _, err := u6.Open(u6.NewSimulator(), u6.WithSerialNumber(1)); err != u6.ErrDeviceNotFound {
+		t.Fatalf("Expected ErrDeviceNotFound; got %v", err)
+	}
+}
+
+func Test_ReadOnly(t *testing.T) {
+	sim := u6.NewSimulator()
+	sim.SetDigital(u6.FIO0, true)
+	dev, err := u6.Open(sim, u6.WithReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dev.Close()
+
+	state := &u6.FeedbackBitStateRead{BitNumber: u6.FIO0}
+	err = dev.Feedback(state, &u6.FeedbackBitStateWrite{BitNumber: u6.FIO1, State: u6.BitStateEnabled})
+	if err != u6.ErrReadOnly {
+		t.Fatalf("Expected ErrReadOnly; got %v", err)
+	} else if _, on := sim.Digital(u6.FIO1); on {
+		t.Fatal("FIO1 was written")
+	}
+
+	if err := dev.Feedback(state); err != nil {
+		t.Fatal(err)
+	} else if !state.GetState() {
+		t.Fatal("Invalid FIO0 state")
+	}
+
+	// Reads of the generic device are allowed
+	if on, err := dev.ReadDigital(context.Background(), int(u6.FIO0)); err != nil || !on {
+		t.Fatalf("Invalid FIO0 read: %v, %v", on, err)
+	}
+}
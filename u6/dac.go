@@ -0,0 +1,95 @@
+package u6
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// ErrDACClipped is returned when a DAC voltage is outside of the output range.
+// The output is still set to the nearest voltage in range.
+var ErrDACClipped = errors.New("DAC voltage clipped to the output range")
+
+// MaxDACVoltage is the maximum voltage of the DAC outputs.
+const MaxDACVoltage = 5.0
+
+// FeedbackDAC16 is the Feedback command for DAC0 (16-bit) and DAC1 (16-bit).
+// Value is in raw counts, see DACCounts.
+type FeedbackDAC16 struct {
+	DAC   int
+	Value uint16
+}
+
+// WriteTo writes the command
+func (f *FeedbackDAC16) WriteTo(w io.Writer) (int, error) {
+	if f.DAC < 0 || f.DAC > 1 {
+		return 0, fmt.Errorf("Invalid DAC %d", f.DAC)
+	}
+
+	buffer := make([]byte, 3)
+	buffer[0] = byte(38 + f.DAC) // IOType for DAC0 (16-bit) or DAC1 (16-bit)
+	buffer[1] = byte(f.Value)    // Value LSB
+	buffer[2] = byte(f.Value >> 8)
+	return w.Write(buffer)
+}
+
+// ReadFrom reads the response
+func (f *FeedbackDAC16) ReadFrom(r io.Reader) (int, error) {
+	return 0, nil
+}
+
+// ResponseSize returns the size of the response
+func (f *FeedbackDAC16) ResponseSize() int {
+	return 0
+}
+
+// SetCalibrationInfo sets the CalibrationInfo
+func (f *FeedbackDAC16) SetCalibrationInfo(info CalibrationInfo) {
+}
+
+func (f *FeedbackDAC16) applyOutput(o *outputState) {
+	o.setDAC(f.DAC, f.Value)
+}
+
+// DACCounts converts volts into the counts of DAC0 or DAC1 using the DAC slope
+// and offset calibration constants. The voltage is clamped to 0-MaxDACVoltage
+// and the counts to 16 bits; clipped reports whether either was clamped.
+func DACCounts(info CalibrationInfo, dac int, volts float64) (counts uint16, clipped bool, err error) {
+	if dac < 0 || dac > 1 {
+		return 0, false, fmt.Errorf("Invalid DAC %d", dac)
+	} else if volts < 0 {
+		volts, clipped = 0, true
+	} else if volts > MaxDACVoltage {
+		volts, clipped = MaxDACVoltage, true
+	}
+
+	value := math.Round(volts*info.CalConstants[16+2*dac] + info.CalConstants[17+2*dac])
+	if value < 0 {
+		return 0, true, nil
+	} else if value > 65535 {
+		return 65535, true, nil
+	}
+	return uint16(value), clipped, nil
+}
+
+// SetDACVoltage sets DAC0 or DAC1 to the voltage using the device calibration.
+// If the voltage is out of range, the output is set to the nearest valid
+// value and ErrDACClipped is returned.
+func (u *U6) SetDACVoltage(dac int, volts float64) error {
+	return u.SetDACVoltageContext(context.Background(), dac, volts)
+}
+
+// SetDACVoltageContext is SetDACVoltage with a context.
+func (u *U6) SetDACVoltageContext(ctx context.Context, dac int, volts float64) error {
+	counts, clipped, err := DACCounts(u.GetCalibrationInfo(), dac, volts)
+	if err != nil {
+		return err
+	} else if err := u.FeedbackContext(ctx, &FeedbackDAC16{DAC: dac, Value: counts}); err != nil {
+		return err
+	} else if clipped {
+		return ErrDACClipped
+	}
+	return nil
+}
@@ -31,20 +31,25 @@ type DeviceDesc struct {
 	LocalID           int
 	VersionInfo       int
 	DeviceType        DeviceType
+
+	// USB location, set when the device is opened over USB.
+	Bus     int
+	Address int
 }
 
 func (d DeviceDesc) String() string {
-	return fmt.Sprintf(`U6 Device Desc: { FirmwareVersion: %s, BootloaderVersion: %s, HardwareVersion: %s, SerialNumber: %d, ProductID: %d, LocalID: %d, VersionInfo: %d, DeviceType: %s}`,
+	return fmt.Sprintf(`U6 Device Desc: { FirmwareVersion: %s, BootloaderVersion: %s, HardwareVersion: %s, SerialNumber: %d, ProductID: %d, LocalID: %d, VersionInfo: %d, DeviceType: %s, Bus: %d, Address: %d}`,
 		d.FirmwareVersion,
 		d.BootloaderVersion,
 		d.HardwareVersion,
 		d.SerialNumber,
 		d.ProductID,
-		d.LocalID, d.VersionInfo, d.DeviceType)
+		d.LocalID, d.VersionInfo, d.DeviceType,
+		d.Bus, d.Address)
 }
 
 func parseConfigBytes(recBuffer []uint8) (DeviceDesc, error) {
-	if len(recBuffer) > 38 {
+	if len(recBuffer) < 38 {
 		return DeviceDesc{}, errors.New("Invalid config response")
 	}
 
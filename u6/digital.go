@@ -0,0 +1,35 @@
+package u6
+
+import (
+	"context"
+)
+
+// DigitalLine is the direction and state of a digital line.
+type DigitalLine struct {
+	Direction BitDirection
+	State     bool
+}
+
+// DigitalState reads the direction and state of all digital lines, indexed by
+// DigitalIOBit. Both are read by a single Feedback command.
+func (u *U6) DigitalState() ([]DigitalLine, error) {
+	return u.DigitalStateContext(context.Background())
+}
+
+// DigitalStateContext is DigitalState with a context.
+func (u *U6) DigitalStateContext(ctx context.Context) ([]DigitalLine, error) {
+	dir := &FeedbackPortDirRead{}
+	state := &FeedbackPortStateRead{}
+	if err := u.FeedbackContext(ctx, dir, state); err != nil {
+		return nil, err
+	}
+
+	lines := make([]DigitalLine, CIO3+1)
+	for bit := range lines {
+		lines[bit] = DigitalLine{
+			Direction: dir.GetDirection(DigitalIOBit(bit)),
+			State:     state.GetState(DigitalIOBit(bit)),
+		}
+	}
+	return lines, nil
+}
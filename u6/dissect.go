@@ -0,0 +1,446 @@
+package u6
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/eliquious/labjack/frame"
+)
+
+// Field is a decoded field of a dissected packet.
+type Field struct {
+	Name  string
+	Value string
+}
+
+// DissectedPacket is a decoded U6 packet.
+type DissectedPacket struct {
+	Direction Direction
+
+	// Command names the command of the packet, see CommandName.
+	Command string
+	Data    []byte
+
+	// ChecksumValid reports whether the packet checksums are valid.
+	ChecksumValid bool
+
+	// Err is the error reported by the U6 or the reason the packet could
+	// not be decoded.
+	Err    error
+	Fields []Field
+}
+
+func (f DissectedPacket) String() string {
+	var b strings.Builder
+	checksum := "checksum ok"
+	if !f.ChecksumValid {
+		checksum = "bad checksum"
+	}
+	fmt.Fprintf(&b, "%-3s %s (%d bytes, %s)", f.Direction, f.Command, len(f.Data), checksum)
+	for _, field := range f.Fields {
+		fmt.Fprintf(&b, "\n    %s: %s", field.Name, field.Value)
+	}
+	if f.Err != nil {
+		fmt.Fprintf(&b, "\n    error: %v", f.Err)
+	}
+	return b.String()
+}
+
+func (f *DissectedPacket) add(name string, format string, args ...interface{}) {
+	f.Fields = append(f.Fields, Field{name, fmt.Sprintf(format, args...)})
+}
+
+// feedbackDecoders decode the Feedback commands by IOType.
+var feedbackDecoders = map[byte]struct {
+	size   int
+	decode func(p []byte) FeedbackCommand
+}{
+	2: {4, func(p []byte) FeedbackCommand {
+		return &FeedbackAIN24{
+			PositiveChannel: int(p[1]),
+			ResolutionIndex: int(p[2] & 0x0F),
+			GainIndex:       int(p[2] >> 4),
+			SettlingFactor:  int(p[3] & 0x7F),
+			Differential:    p[3]&0x80 != 0,
+		}
+	}},
+	3: {4, func(p []byte) FeedbackCommand {
+		return &FeedbackAIN24AR{
+			PositiveChannel: int(p[1]),
+			ResolutionIndex: int(p[2] & 0x0F),
+			GainIndex:       int(p[2] >> 4),
+			SettlingFactor:  int(p[3] & 0x7F),
+			Differential:    p[3]&0x80 != 0,
+		}
+	}},
+	10: {2, func(p []byte) FeedbackCommand {
+		return &FeedbackBitStateRead{BitNumber: DigitalIOBit(p[1] & 0x1F)}
+	}},
+	11: {2, func(p []byte) FeedbackCommand {
+		return &FeedbackBitStateWrite{BitNumber: DigitalIOBit(p[1] & 0x1F), State: BitState(p[1] & 0x80)}
+	}},
+	12: {2, func(p []byte) FeedbackCommand {
+		return &FeedbackBitDirRead{BitNumber: DigitalIOBit(p[1] & 0x1F)}
+	}},
+	13: {2, func(p []byte) FeedbackCommand {
+		return &FeedbackBitDirWrite{BitNumber: DigitalIOBit(p[1] & 0x1F), Direction: BitDirection(p[1] & 0x80)}
+	}},
+	26: {1, func(p []byte) FeedbackCommand {
+		return &FeedbackPortStateRead{}
+	}},
+	27: {7, func(p []byte) FeedbackCommand {
+		return &FeedbackPortStateWrite{
+			FIOWriteMask: p[1], EIOWriteMask: p[2], CIOWriteMask: p[3],
+			FIOState: p[4], EIOState: p[5], CIOState: p[6],
+		}
+	}},
+	28: {1, func(p []byte) FeedbackCommand {
+		return &FeedbackPortDirRead{}
+	}},
+	29: {7, func(p []byte) FeedbackCommand {
+		return &FeedbackPortDirWrite{
+			FIOWriteMask: p[1], EIOWriteMask: p[2], CIOWriteMask: p[3],
+			FIODirection: p[4], EIODirection: p[5], CIODirection: p[6],
+		}
+	}},
+	38: {3, func(p []byte) FeedbackCommand {
+		return &FeedbackDAC16{DAC: 0, Value: uint16(p[1]) | uint16(p[2])<<8}
+	}},
+	39: {3, func(p []byte) FeedbackCommand {
+		return &FeedbackDAC16{DAC: 1, Value: uint16(p[1]) | uint16(p[2])<<8}
+	}},
+}
+
+// describeCommand describes the fields of a Feedback command.
+func describeCommand(cmd FeedbackCommand) string {
+	switch c := cmd.(type) {
+	case *FeedbackAIN24:
+		return fmt.Sprintf("AIN%d resolution=%d gain=%d settling=%d differential=%t",
+			c.PositiveChannel, c.ResolutionIndex, c.GainIndex, c.SettlingFactor, c.Differential)
+	case *FeedbackAIN24AR:
+		return fmt.Sprintf("AIN%d resolution=%d gain=%d settling=%d differential=%t",
+			c.PositiveChannel, c.ResolutionIndex, c.GainIndex, c.SettlingFactor, c.Differential)
+	case *FeedbackBitStateRead:
+		return c.BitNumber.String()
+	case *FeedbackBitDirRead:
+		return c.BitNumber.String()
+	case *FeedbackBitStateWrite:
+		return fmt.Sprintf("%s state=%d", c.BitNumber, c.State>>7)
+	case *FeedbackBitDirWrite:
+		return fmt.Sprintf("%s direction=%s", c.BitNumber, describeDirection(c.Direction))
+	case *FeedbackPortStateRead, *FeedbackPortDirRead:
+		return ""
+	case *FeedbackPortStateWrite:
+		return fmt.Sprintf("mask FIO=%#02x EIO=%#02x CIO=%#02x state FIO=%#02x EIO=%#02x CIO=%#02x",
+			c.FIOWriteMask, c.EIOWriteMask, c.CIOWriteMask, c.FIOState, c.EIOState, c.CIOState)
+	case *FeedbackPortDirWrite:
+		return fmt.Sprintf("mask FIO=%#02x EIO=%#02x CIO=%#02x direction FIO=%#02x EIO=%#02x CIO=%#02x",
+			c.FIOWriteMask, c.EIOWriteMask, c.CIOWriteMask, c.FIODirection, c.EIODirection, c.CIODirection)
+	case *FeedbackDAC16:
+		return fmt.Sprintf("DAC%d value=%#06x", c.DAC, c.Value)
+	}
+	return fmt.Sprintf("%T", cmd)
+}
+
+// describeResponse describes the response of a Feedback command. Commands
+// without a response are described by an empty string.
+func describeResponse(cmd FeedbackCommand) string {
+	switch c := cmd.(type) {
+	case *FeedbackAIN24:
+		voltage, err := c.GetVoltage()
+		if err != nil {
+			return err.Error()
+		}
+		raw := uint(c.responseBuffer[0]) + uint(c.responseBuffer[1])*256 + uint(c.responseBuffer[2])*65536
+		return fmt.Sprintf("AIN%d = %.6f V (raw %#06x)", c.PositiveChannel, voltage, raw)
+	case *FeedbackAIN24AR:
+		voltage, err := c.GetVoltage()
+		if err != nil {
+			return err.Error()
+		}
+		return fmt.Sprintf("AIN%d = %.6f V (raw %#06x gain=%d status=%#02x)",
+			c.PositiveChannel, voltage, c.GetRaw(), c.GetGainIndex(), c.GetStatus())
+	case *FeedbackBitStateRead:
+		return fmt.Sprintf("%s = %d", c.BitNumber, c.state)
+	case *FeedbackBitDirRead:
+		return fmt.Sprintf("%s = %s", c.BitNumber, describeDirection(c.GetDirection()))
+	case *FeedbackPortStateRead:
+		fio, eio, cio := c.GetPorts()
+		return fmt.Sprintf("FIO=%#02x EIO=%#02x CIO=%#02x", fio, eio, cio)
+	case *FeedbackPortDirRead:
+		fio, eio, cio := c.GetPorts()
+		return fmt.Sprintf("FIO=%#02x EIO=%#02x CIO=%#02x", fio, eio, cio)
+	}
+	return ""
+}
+
+func describeDirection(d BitDirection) string {
+	if d == BitDirectionWrite {
+		return "output"
+	}
+	return "input"
+}
+
+func channelName(channel byte) string {
+	switch channel {
+	case 193:
+		return "FIO/EIO"
+	case 194:
+		return "CIO"
+	}
+	return fmt.Sprintf("AIN%d", channel)
+}
+
+// Dissector decodes captured U6 packets for display. Responses and stream
+// data are decoded using the preceding commands, so packets must be given in
+// capture order. Calibration constants read in the capture replace the
+// default calibration.
+type Dissector struct {
+	calibration  CalibrationInfo
+	feedback     []FeedbackCommand
+	ioTypes      []byte
+	calBlock     int
+	stream       *StreamConfig
+	channelIndex int
+}
+
+// NewDissector creates a Dissector.
+func NewDissector() *Dissector {
+	return &Dissector{calibration: DefaultCalibrationInfo, calBlock: -1}
+}
+
+// Dissect decodes a packet. A stream transfer holding several stream data
+// packets is split into one DissectedPacket per stream packet.
+func (d *Dissector) Dissect(dir Direction, p []byte) []DissectedPacket {
+	if len(p) < 4 || p[1] != frame.StreamDataCommand {
+		return []DissectedPacket{d.dissect(dir, p)}
+	}
+
+	var packets []DissectedPacket
+	for len(p) > 0 {
+		size := len(p)
+		if len(p) > 2 && frame.HeaderSize+2*int(p[2]) < size {
+			size = frame.HeaderSize + 2*int(p[2])
+		}
+		packets = append(packets, d.dissect(dir, p[:size]))
+		p = p[size:]
+	}
+	return packets
+}
+
+func (d *Dissector) dissect(dir Direction, p []byte) DissectedPacket {
+	f := DissectedPacket{Direction: dir, Command: CommandName(p), Data: p, ChecksumValid: checksumValid(p)}
+	if !f.ChecksumValid {
+		f.Err = ErrInvalidChecksum
+		return f
+	}
+
+	switch {
+	case f.Command == "Feedback" && dir == DirectionOut:
+		d.feedbackCommand(&f)
+	case f.Command == "Feedback":
+		d.feedbackResponse(&f)
+	case f.Command == "ConfigU6" && dir == DirectionIn:
+		d.configU6Response(&f)
+	case f.Command == "ReadCal" && dir == DirectionOut:
+		d.calBlock = -1
+		if len(p) > 7 {
+			d.calBlock = int(p[7])
+			f.add("block", "%d", d.calBlock)
+		}
+	case f.Command == "ReadCal":
+		d.readCalResponse(&f)
+	case f.Command == "StreamConfig" && dir == DirectionOut:
+		d.streamConfig(&f)
+	case f.Command == "StreamData":
+		d.streamData(&f)
+	case f.Command == "StreamStart" && dir == DirectionIn, f.Command == "StreamStop" && dir == DirectionIn:
+		_, f.Err = frame.ParseNormal(p, p[1])
+	case dir == DirectionIn && p[1] == frame.ExtendedCommand:
+		_, f.Err = frame.ParseExtended(p, p[3])
+	}
+	f.Err = responseError(f.Err)
+	return f
+}
+
+// checksumValid reports whether the checksums of a packet are valid.
+func checksumValid(p []byte) bool {
+	if len(p) < 2 {
+		return false
+	} else if p[1] == frame.ExtendedCommand || p[1] == frame.StreamDataCommand {
+		if len(p) < frame.HeaderSize {
+			return false
+		}
+		sum := frame.Checksum16(p[frame.HeaderSize:])
+		return p[0] == frame.Checksum8(p[1:frame.HeaderSize]) && p[4] == byte(sum) && p[5] == byte(sum>>8)
+	}
+	return p[0] == frame.Checksum8(p[1:])
+}
+
+func (d *Dissector) feedbackCommand(f *DissectedPacket) {
+	d.feedback, d.ioTypes = nil, nil
+	if len(f.Data) <= frame.HeaderSize {
+		f.Err = ErrResponseTooShort
+		return
+	}
+	f.add("echo", "%#02x", f.Data[frame.HeaderSize])
+
+	data := f.Data[frame.HeaderSize+1:]
+	for len(data) > 0 {
+		decoder, ok := feedbackDecoders[data[0]]
+		if !ok && len(data) == 1 && data[0] == 0 {
+			// Padding
+			break
+		} else if !ok {
+			f.Err = fmt.Errorf("Unknown IOType %d", data[0])
+			return
+		} else if len(data) < decoder.size {
+			f.Err = fmt.Errorf("%s: %w", ioTypeName(data[0]), ErrResponseTooShort)
+			return
+		}
+
+		cmd := decoder.decode(data)
+		cmd.SetCalibrationInfo(d.calibration)
+		f.add(fmt.Sprintf("[%d] %s", len(d.feedback), ioTypeName(data[0])), "%s", describeCommand(cmd))
+		d.feedback = append(d.feedback, cmd)
+		d.ioTypes = append(d.ioTypes, data[0])
+		data = data[decoder.size:]
+	}
+}
+
+func (d *Dissector) feedbackResponse(f *DissectedPacket) {
+	resp, err := frame.ParseExtended(f.Data, 0x00)
+	if len(resp.Data) < 3 {
+		f.Err = err
+		return
+	}
+	f.add("echo", "%#02x", resp.Data[2])
+
+	var code frame.ErrorCode
+	if errors.As(err, &code) {
+		f.Err = newFeedbackError(d.feedback, d.ioTypes, int(resp.Data[1]), ErrorCode(code))
+		return
+	} else if err != nil {
+		f.Err = err
+		return
+	} else if d.feedback == nil {
+		f.add("data", "% x", resp.Data[3:])
+		return
+	}
+
+	if _, err := populate(d.feedback, resp.Data[3:]); err != nil {
+		f.Err = err
+		return
+	}
+	for i, cmd := range d.feedback {
+		if desc := describeResponse(cmd); desc != "" {
+			f.add(fmt.Sprintf("[%d] %s", i, ioTypeName(d.ioTypes[i])), "%s", desc)
+		}
+	}
+}
+
+func (d *Dissector) configU6Response(f *DissectedPacket) {
+	if _, f.Err = frame.ParseExtended(f.Data, 0x08); f.Err != nil {
+		return
+	}
+
+	desc, err := parseConfigBytes(f.Data)
+	if err != nil {
+		f.Err = err
+		return
+	}
+	d.calibration.HiResolution = f.Data[37]&8 == 8
+
+	f.add("device type", "%s", desc.DeviceType)
+	f.add("serial number", "%d", desc.SerialNumber)
+	f.add("firmware", "%s", desc.FirmwareVersion)
+	f.add("bootloader", "%s", desc.BootloaderVersion)
+	f.add("hardware", "%s", desc.HardwareVersion)
+	f.add("local ID", "%d", desc.LocalID)
+}
+
+func (d *Dissector) readCalResponse(f *DissectedPacket) {
+	if _, f.Err = frame.ParseExtended(f.Data, 0x2D); f.Err != nil {
+		return
+	} else if len(f.Data) < 40 {
+		f.Err = ErrResponseTooShort
+		return
+	} else if d.calBlock < 0 || d.calBlock > 9 {
+		f.add("data", "% x", f.Data[8:])
+		return
+	}
+
+	for i, c := range calibrationBlock(f.Data) {
+		d.calibration.CalConstants[d.calBlock*4+i] = c
+		f.add(fmt.Sprintf("constant %d", d.calBlock*4+i), "%v", c)
+	}
+}
+
+func (d *Dissector) streamConfig(f *DissectedPacket) {
+	config, err := parseStreamConfig(f.Data[frame.HeaderSize:])
+	if err != nil {
+		f.Err = err
+		return
+	}
+	d.stream, d.channelIndex = config, 0
+
+	f.add("resolution", "%d", config.ResolutionIndex)
+	f.add("samples per packet", "%d", config.SamplesPerPacket)
+	f.add("settling factor", "%d", config.SettlingFactor)
+	f.add("scan interval", "%d (clock=%d divide by 256=%t)", config.ScanConfig.ScanInterval,
+		config.ScanConfig.ClockSpeed, config.ScanConfig.DivideBy256 == ClockDivisionOn)
+	for i, ch := range config.Channels {
+		f.add(fmt.Sprintf("channel %d", i), "%s gain=%d differential=%t",
+			channelName(ch.PositiveChannel), ch.GainIndex, ch.Differential == DifferentialInputEnabled)
+	}
+}
+
+func (d *Dissector) streamData(f *DissectedPacket) {
+	if len(f.Data) < 16 || len(f.Data)%2 != 0 {
+		f.Err = fmt.Errorf("Invalid stream packet size %d", len(f.Data))
+		return
+	}
+
+	samples := (len(f.Data) - 14) / 2
+	if d.stream != nil {
+		samples = int(d.stream.SamplesPerPacket)
+	}
+
+	packet, err := parseStreamPacket(f.Data, samples)
+	if err != nil {
+		f.Err = err
+		return
+	}
+
+	f.add("packet", "%d", packet.PacketNumber)
+	f.add("backlog", "%d", packet.Backlog)
+	if packet.ErrorCode == ErrStreamAutoRecoverReport {
+		f.add("dropped scans", "%d", packet.Dropped)
+	}
+	if packet.ErrorCode != 0 {
+		f.Err = packet.ErrorCode
+	}
+
+	for _, raw := range packet.Samples {
+		if d.stream == nil || len(d.stream.Channels) == 0 {
+			f.add("sample", "%#04x", raw)
+			continue
+		}
+
+		ch := d.stream.Channels[d.channelIndex]
+		d.channelIndex = (d.channelIndex + 1) % len(d.stream.Channels)
+		if ch.PositiveChannel >= 193 {
+			f.add(channelName(ch.PositiveChannel), "%016b", raw)
+			continue
+		}
+
+		data := ChannelData{Raw: raw, calInfo: d.calibration, config: d.stream, channelConfig: ch}
+		voltage, err := data.GetCalibratedAIN()
+		if err != nil {
+			f.add(channelName(ch.PositiveChannel), "%#04x (%v)", raw, err)
+			continue
+		}
+		f.add(channelName(ch.PositiveChannel), "%.6f V (raw %#04x)", voltage, raw)
+	}
+}
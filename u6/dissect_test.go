@@ -0,0 +1,152 @@
+package u6_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eliquious/labjack/u6"
+)
+
+// capture records the packets of a U6 with the trace hook.
+type capture struct {
+	mu     sync.Mutex
+	traces []u6.Trace
+}
+
+func (c *capture) trace(trace u6.Trace) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	trace.Data = append([]byte(nil), trace.Data...)
+	c.traces = append(c.traces, trace)
+}
+
+func (c *capture) dissect() []u6.DissectedPacket {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d := u6.NewDissector()
+	var packets []u6.DissectedPacket
+	for _, trace := range c.traces {
+		packets = append(packets, d.Dissect(trace.Direction, trace.Data)...)
+	}
+	return packets
+}
+
+func field(f u6.DissectedPacket, name string) string {
+	for _, field := range f.Fields {
+		if field.Name == name {
+			return field.Value
+		}
+	}
+	return ""
+}
+
+func Test_DissectFeedback(t *testing.T) {
+	sim, dev := openSimulator(t)
+	defer dev.Close()
+	sim.SetAIN(0, 1.25)
+	sim.SetDigital(u6.FIO2, true)
+
+	c := &capture{}
+	dev.SetTrace(c.trace)
+	err := dev.Feedback(
+		&u6.FeedbackAIN24{PositiveChannel: 0, ResolutionIndex: 8},
+		&u6.FeedbackBitStateRead{BitNumber: u6.FIO2},
+		&u6.FeedbackBitDirWrite{BitNumber: u6.EIO1, Direction: u6.BitDirectionWrite},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packets := c.dissect()
+	if len(packets) != 2 {
+		t.Fatalf("Expected 2 packets; got %d", len(packets))
+	}
+
+	command, response := packets[0], packets[1]
+	if !command.ChecksumValid || command.Err != nil || command.Command != "Feedback" {
+		t.Fatalf("Invalid command frame: %v", command)
+	} else if field(command, "[0] AIN24") != "AIN0 resolution=8 gain=0 settling=0 differential=false" {
+		t.Fatalf("Invalid AIN24 command: %v", command)
+	} else if field(command, "[2] BitDirWrite") != "EIO1 direction=output" {
+		t.Fatalf("Invalid BitDirWrite command: %v", command)
+	}
+
+	if !response.ChecksumValid || response.Err != nil {
+		t.Fatalf("Invalid response frame: %v", response)
+	} else if !strings.HasPrefix(field(response, "[0] AIN24"), "AIN0 = 1.2") {
+		t.Fatalf("Invalid AIN24 response: %v", response)
+	} else if field(response, "[1] BitStateRead") != "FIO2 = 1" {
+		t.Fatalf("Invalid BitStateRead response: %v", response)
+	}
+}
+
+func Test_DissectStream(t *testing.T) {
+	sim, dev := openSimulator(t)
+	defer dev.Close()
+	sim.SetDigital(u6.FIO3, true)
+
+	c := &capture{}
+	dev.SetTrace(c.trace)
+	stream, err := dev.NewStream(&u6.StreamConfig{
+		ResolutionIndex:  1,
+		SamplesPerPacket: 2,
+		ScanConfig:       &u6.ScanConfig{ClockSpeed: u6.ClockSpeed4Mhz, DivideBy256: u6.ClockDivisionOn, ScanInterval: 15625},
+		Channels:         []u6.ChannelConfig{{PositiveChannel: 193}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch, err := stream.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatal("No stream data")
+	}
+	stream.Stop()
+	dev.SetTrace(nil)
+
+	var config, data *u6.DissectedPacket
+	packets := c.dissect()
+	for i := range packets {
+		if packets[i].Command == "StreamConfig" && packets[i].Direction == u6.DirectionOut && config == nil {
+			config = &packets[i]
+		} else if packets[i].Command == "StreamData" && data == nil {
+			data = &packets[i]
+		}
+	}
+
+	if config == nil || data == nil {
+		t.Fatalf("Missing packets: %v", packets)
+	} else if field(*config, "channel 0") != "FIO/EIO gain=0 differential=false" {
+		t.Fatalf("Invalid StreamConfig: %v", *config)
+	} else if data.Err != nil || field(*data, "FIO/EIO") != "0000000000001000" {
+		t.Fatalf("Invalid StreamData: %v", *data)
+	}
+}
+
+func FuzzDissect(f *testing.F) {
+	f.Add([]byte{0x2F, 0xF8, 0x02, 0x00, 0x34, 0x00, 0x2A, 0x0A, 0x00, 0x00}, []byte{0xB8, 0xB8})
+	f.Add([]byte{}, []byte{0xBA, 0xF9, 0x00, 0xC0, 0x00, 0x00})
+	f.Fuzz(func(t *testing.T, command, response []byte) {
+		d := u6.NewDissector()
+		packets := d.Dissect(u6.DirectionOut, command)
+		packets = append(packets, d.Dissect(u6.DirectionIn, response)...)
+		for _, packet := range packets {
+			_ = packet.String()
+		}
+	})
+}
+
+func Test_DissectMalformed(t *testing.T) {
+	d := u6.NewDissector()
+	packets := d.Dissect(u6.DirectionIn, []byte{0xBA, 0xF9, 0x00, 0xC0, 0x00, 0x00})
+	if len(packets) != 1 || packets[0].Err == nil {
+		t.Fatalf("Expected an undecodable packet; got %v", packets)
+	}
+}
@@ -0,0 +1,196 @@
+package u6
+
+import "fmt"
+
+// ErrorCode is a low-level error code reported by the U6 in a command
+// response or a stream packet. The constants are sentinels for errors.Is:
+//
+//	if errors.Is(err, u6.ErrStreamNotRunning) { ... }
+type ErrorCode byte
+
+// ErrLabJackErrorCode is the former name of ErrorCode.
+type ErrLabJackErrorCode = ErrorCode
+
+// Low-level error codes from the U6 User's Guide. Codes which are not listed
+// are reported as UNKNOWN.
+const (
+	ErrScratchWriteFail          ErrorCode = 1
+	ErrScratchEraseFail          ErrorCode = 2
+	ErrDataBufferOverflow        ErrorCode = 3
+	ErrADC0BufferOverflow        ErrorCode = 4
+	ErrFunctionInvalid           ErrorCode = 5
+	ErrSWDTTimeInvalid           ErrorCode = 6
+	ErrXBRConfigError            ErrorCode = 7
+	ErrFlashWriteFail            ErrorCode = 16
+	ErrFlashEraseFail            ErrorCode = 17
+	ErrFlashJumpFail             ErrorCode = 18
+	ErrFlashPSPTimeout           ErrorCode = 19
+	ErrFlashAbortReceived        ErrorCode = 20
+	ErrFlashPageMismatch         ErrorCode = 21
+	ErrFlashBlockMismatch        ErrorCode = 22
+	ErrFlashPageNotInCodeArea    ErrorCode = 23
+	ErrMemIllegalAddress         ErrorCode = 24
+	ErrFlashLocked               ErrorCode = 25
+	ErrInvalidBlock              ErrorCode = 26
+	ErrFlashIllegalPage          ErrorCode = 27
+	ErrFlashTooManyBytes         ErrorCode = 28
+	ErrFlashInvalidStringNum     ErrorCode = 29
+	ErrSHT1xCommTimeout          ErrorCode = 40
+	ErrSHT1xNoAck                ErrorCode = 41
+	ErrSHT1xCRCFailed            ErrorCode = 42
+	ErrSHT1xTooManyWriteBytes    ErrorCode = 43
+	ErrSHT1xTooManyReadBytes     ErrorCode = 44
+	ErrSHT1xInvalidMode          ErrorCode = 45
+	ErrSHT1xInvalidLine          ErrorCode = 46
+	ErrStreamIsActive            ErrorCode = 48
+	ErrStreamTableInvalid        ErrorCode = 49
+	ErrStreamConfigInvalid       ErrorCode = 50
+	ErrStreamBadTriggerSource    ErrorCode = 51
+	ErrStreamNotRunning          ErrorCode = 52
+	ErrStreamInvalidTrigger      ErrorCode = 53
+	ErrStreamADC0BufferOverflow  ErrorCode = 54
+	ErrStreamScanOverlap         ErrorCode = 55
+	ErrStreamSampleNumInvalid    ErrorCode = 56
+	ErrStreamBipolarGainInvalid  ErrorCode = 57
+	ErrStreamScanRateInvalid     ErrorCode = 58
+	ErrStreamAutoRecoverActive   ErrorCode = 59
+	ErrStreamAutoRecoverReport   ErrorCode = 60
+	ErrStreamAutoRecoverOverflow ErrorCode = 63
+	ErrTimerInvalidMode          ErrorCode = 64
+	ErrTimerQuadratureABError    ErrorCode = 65
+	ErrTimerQuadPulseSequence    ErrorCode = 66
+	ErrTimerBadClockSource       ErrorCode = 67
+	ErrTimerStreamActive         ErrorCode = 68
+	ErrTimerPWMStopModuleError   ErrorCode = 69
+	ErrTimerSequenceError        ErrorCode = 70
+	ErrTimerLineSequenceError    ErrorCode = 71
+	ErrTimerSharingError         ErrorCode = 72
+	ErrExtOscNotStable           ErrorCode = 80
+	ErrInvalidPowerSetting       ErrorCode = 81
+	ErrPLLNotLocked              ErrorCode = 82
+	ErrInvalidPin                ErrorCode = 96
+	ErrPinConfiguredForAnalog    ErrorCode = 97
+	ErrPinConfiguredForDigital   ErrorCode = 98
+	ErrIOTypeSynchError          ErrorCode = 99
+	ErrInvalidOffset             ErrorCode = 100
+	ErrIOTypeNotValid            ErrorCode = 101
+	ErrTCPinOffset               ErrorCode = 102
+	ErrUARTTimeout               ErrorCode = 112
+	ErrUARTNotConnected          ErrorCode = 113
+	ErrUARTNotEnabled            ErrorCode = 114
+	ErrI2CBusBusy                ErrorCode = 115
+	ErrTooManyBytes              ErrorCode = 116
+	ErrTooFewBytes               ErrorCode = 117
+	ErrDSPPeriodDetection        ErrorCode = 118
+	ErrDSPSignalOutOfRange       ErrorCode = 119
+	ErrModbusResponseOverflow    ErrorCode = 120
+	ErrModbusCommandOverflow     ErrorCode = 121
+)
+
+type errorCodeInfo struct {
+	name        string
+	description string
+	transient   bool
+}
+
+var errorCodes = map[ErrorCode]errorCodeInfo{
+	ErrScratchWriteFail:          {"SCRATCH_WRT_FAIL", "Scratch pad write failed", false},
+	ErrScratchEraseFail:          {"SCRATCH_ERASE_FAIL", "Scratch pad erase failed", false},
+	ErrDataBufferOverflow:        {"DATA_BUFFER_OVERFLOW", "Data buffer overflow", true},
+	ErrADC0BufferOverflow:        {"ADC0_BUFFER_OVERFLOW", "ADC buffer overflow", true},
+	ErrFunctionInvalid:           {"FUNCTION_INVALID", "Function is not valid", false},
+	ErrSWDTTimeInvalid:           {"SWDT_TIME_INVALID", "Watchdog time is not valid", false},
+	ErrXBRConfigError:            {"XBR_CONFIG_ERROR", "Crossbar configuration error", false},
+	ErrFlashWriteFail:            {"FLASH_WRITE_FAIL", "Flash write failed", false},
+	ErrFlashEraseFail:            {"FLASH_ERASE_FAIL", "Flash erase failed", false},
+	ErrFlashJumpFail:             {"FLASH_JMP_FAIL", "Flash jump failed", false},
+	ErrFlashPSPTimeout:           {"FLASH_PSP_TIMEOUT", "Flash timed out", true},
+	ErrFlashAbortReceived:        {"FLASH_ABORT_RECEIVED", "Flash operation aborted", false},
+	ErrFlashPageMismatch:         {"FLASH_PAGE_MISMATCH", "Flash page mismatch", false},
+	ErrFlashBlockMismatch:        {"FLASH_BLOCK_MISMATCH", "Flash block mismatch", false},
+	ErrFlashPageNotInCodeArea:    {"FLASH_PAGE_NOT_IN_CODE_AREA", "Flash page is not in the code area", false},
+	ErrMemIllegalAddress:         {"MEM_ILLEGAL_ADDRESS", "Illegal memory address", false},
+	ErrFlashLocked:               {"FLASH_LOCKED", "Flash is locked", false},
+	ErrInvalidBlock:              {"INVALID_BLOCK", "Memory block is not valid", false},
+	ErrFlashIllegalPage:          {"FLASH_ILLEGAL_PAGE", "Illegal flash page", false},
+	ErrFlashTooManyBytes:         {"FLASH_TOO_MANY_BYTES", "Too many bytes for flash", false},
+	ErrFlashInvalidStringNum:     {"FLASH_INVALID_STRING_NUM", "Flash string number is not valid", false},
+	ErrSHT1xCommTimeout:          {"SHT1x_COMM_TIME_OUT", "SHT1x communication timed out", true},
+	ErrSHT1xNoAck:                {"SHT1x_NO_ACK", "SHT1x did not acknowledge", true},
+	ErrSHT1xCRCFailed:            {"SHT1x_CRC_FAILED", "SHT1x CRC check failed", true},
+	ErrSHT1xTooManyWriteBytes:    {"SHT1X_TOO_MANY_W_BYTES", "Too many SHT1x bytes to write", false},
+	ErrSHT1xTooManyReadBytes:     {"SHT1X_TOO_MANY_R_BYTES", "Too many SHT1x bytes to read", false},
+	ErrSHT1xInvalidMode:          {"SHT1X_INVALID_MODE", "SHT1x mode is not valid", false},
+	ErrSHT1xInvalidLine:          {"SHT1X_INVALID_LINE", "SHT1x line is not valid", false},
+	ErrStreamIsActive:            {"STREAM_IS_ACTIVE", "Stream is active", false},
+	ErrStreamTableInvalid:        {"STREAM_TABLE_INVALID", "Stream channel table is not valid", false},
+	ErrStreamConfigInvalid:       {"STREAM_CONFIG_INVALID", "Stream configuration is not valid", false},
+	ErrStreamBadTriggerSource:    {"STREAM_BAD_TRIGGER_SOURCE", "Stream trigger source is not valid", false},
+	ErrStreamNotRunning:          {"STREAM_NOT_RUNNING", "Stream is not running", false},
+	ErrStreamInvalidTrigger:      {"STREAM_INVALID_TRIGGER", "Stream trigger is not valid", false},
+	ErrStreamADC0BufferOverflow:  {"STREAM_ADC0_BUFFER_OVERFLOW", "Stream ADC buffer overflow", true},
+	ErrStreamScanOverlap:         {"STREAM_SCAN_OVERLAP", "Stream scan started before the previous scan completed", true},
+	ErrStreamSampleNumInvalid:    {"STREAM_SAMPLE_NUM_INVALID", "Stream samples per packet is not valid", false},
+	ErrStreamBipolarGainInvalid:  {"STREAM_BIPOLAR_GAIN_INVALID", "Stream bipolar gain is not valid", false},
+	ErrStreamScanRateInvalid:     {"STREAM_SCAN_RATE_INVALID", "Stream scan rate is not valid", false},
+	ErrStreamAutoRecoverActive:   {"STREAM_AUTORECOVER_ACTIVE", "Stream buffer overflowed; auto-recovery is active", true},
+	ErrStreamAutoRecoverReport:   {"STREAM_AUTORECOVER_REPORT", "Stream auto-recovery ended; scans were dropped", true},
+	ErrStreamAutoRecoverOverflow: {"STREAM_AUTORECOVER_OVERFLOW", "Stream auto-recovery overflowed", true},
+	ErrTimerInvalidMode:          {"TIMER_INVALID_MODE", "Timer mode is not valid", false},
+	ErrTimerQuadratureABError:    {"TIMER_QUADRATURE_AB_ERROR", "Timer quadrature A/B error", false},
+	ErrTimerQuadPulseSequence:    {"TIMER_QUAD_PULSE_SEQUENCE", "Timer quadrature pulse sequence error", false},
+	ErrTimerBadClockSource:       {"TIMER_BAD_CLOCK_SOURCE", "Timer clock source is not valid", false},
+	ErrTimerStreamActive:         {"TIMER_STREAM_ACTIVE", "Timer cannot be changed while streaming", false},
+	ErrTimerPWMStopModuleError:   {"TIMER_PWMSTOP_MODULE_ERROR", "Timer PWM stop module error", false},
+	ErrTimerSequenceError:        {"TIMER_SEQUENCE_ERROR", "Timer sequence error", false},
+	ErrTimerLineSequenceError:    {"TIMER_LINE_SEQUENCE_ERROR", "Timer line sequence error", false},
+	ErrTimerSharingError:         {"TIMER_SHARING_ERROR", "Timer sharing error", false},
+	ErrExtOscNotStable:           {"EXT_OSC_NOT_STABLE", "External oscillator is not stable", true},
+	ErrInvalidPowerSetting:       {"INVALID_POWER_SETTING", "Power setting is not valid", false},
+	ErrPLLNotLocked:              {"PLL_NOT_LOCKED", "PLL is not locked", true},
+	ErrInvalidPin:                {"INVALID_PIN", "Pin is not valid", false},
+	ErrPinConfiguredForAnalog:    {"PIN_CONFIGURED_FOR_ANALOG", "Pin is configured for analog", false},
+	ErrPinConfiguredForDigital:   {"PIN_CONFIGURED_FOR_DIGITAL", "Pin is configured for digital", false},
+	ErrIOTypeSynchError:          {"IOTYPE_SYNCH_ERROR", "IOType synchronization error", false},
+	ErrInvalidOffset:             {"INVALID_OFFSET", "Offset is not valid", false},
+	ErrIOTypeNotValid:            {"IOTYPE_NOT_VALID", "IOType is not valid", false},
+	ErrTCPinOffset:               {"TC_PIN_OFFSET_MUST_BE_4-8", "Timer/counter pin offset must be 4-8", false},
+	ErrUARTTimeout:               {"UART_TIMEOUT", "UART timed out", true},
+	ErrUARTNotConnected:          {"UART_NOTCONNECTED", "UART is not connected", false},
+	ErrUARTNotEnabled:            {"UART_NOTENABLED", "UART is not enabled", false},
+	ErrI2CBusBusy:                {"I2C_BUS_BUSY", "I2C bus is busy", true},
+	ErrTooManyBytes:              {"TOO_MANY_BYTES", "Too many bytes", false},
+	ErrTooFewBytes:               {"TOO_FEW_BYTES", "Too few bytes", false},
+	ErrDSPPeriodDetection:        {"DSP_PERIOD_DETECTION_ERROR", "DSP period detection error", true},
+	ErrDSPSignalOutOfRange:       {"DSP_SIGNAL_OUT_OF_RANGE", "DSP signal out of range", true},
+	ErrModbusResponseOverflow:    {"MODBUS_RSP_OVERFLOW", "Modbus response overflow", false},
+	ErrModbusCommandOverflow:     {"MODBUS_CMD_OVERFLOW", "Modbus command overflow", false},
+}
+
+// Name returns the name of the error code in the U6 User's Guide.
+func (e ErrorCode) Name() string {
+	if info, ok := errorCodes[e]; ok {
+		return info.name
+	}
+	return "UNKNOWN"
+}
+
+// Description describes the error code.
+func (e ErrorCode) Description() string {
+	if info, ok := errorCodes[e]; ok {
+		return info.description
+	}
+	return "Unknown error code"
+}
+
+// Transient reports whether the error comes from a passing condition, such as
+// a buffer overflow or a bus timeout, so that the operation may succeed if it
+// is repeated. All other codes are fatal: the command or configuration must
+// be changed.
+func (e ErrorCode) Transient() bool {
+	return errorCodes[e].transient
+}
+
+func (e ErrorCode) Error() string {
+	return fmt.Sprintf("LabJack error code %d (%s): %s", byte(e), e.Name(), e.Description())
+}
@@ -0,0 +1,73 @@
+package u6_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/eliquious/labjack/u6"
+)
+
+// invalidIOType is a Feedback command with an IOType the U6 does not know.
+type invalidIOType struct{}
+
+func (invalidIOType) WriteTo(w io.Writer) (int, error)           { return w.Write([]byte{0x7F}) }
+func (invalidIOType) ReadFrom(r io.Reader) (int, error)          { return 0, nil }
+func (invalidIOType) ResponseSize() int                          { return 0 }
+func (invalidIOType) SetCalibrationInfo(info u6.CalibrationInfo) {}
+
+func Test_ErrorCode(t *testing.T) {
+	err := fmt.Errorf("stop: %w", u6.ErrorCode(52))
+	if !errors.Is(err, u6.ErrStreamNotRunning) {
+		t.Fatalf("Expected ErrStreamNotRunning; got %v", err)
+	} else if !strings.Contains(err.Error(), "STREAM_NOT_RUNNING") {
+		t.Fatalf("Invalid error message: %v", err)
+	}
+
+	if u6.ErrorCode(250).Name() != "UNKNOWN" {
+		t.Fatalf("Invalid name: %s", u6.ErrorCode(250).Name())
+	}
+
+	if !u6.ErrStreamAutoRecoverActive.Transient() || u6.ErrStreamConfigInvalid.Transient() {
+		t.Fatal("Invalid transient classification")
+	} else if !u6.IsRetryable(u6.ErrI2CBusBusy) || u6.IsRetryable(u6.ErrIOTypeNotValid) {
+		t.Fatal("Invalid retry classification")
+	}
+}
+
+func Test_FeedbackErrorCode(t *testing.T) {
+	_, dev := openSimulator(t)
+	defer dev.Close()
+
+	err := dev.Feedback(&u6.FeedbackBitStateRead{BitNumber: u6.FIO0}, invalidIOType{})
+	if !errors.Is(err, u6.ErrIOTypeNotValid) {
+		t.Fatalf("Expected ErrIOTypeNotValid; got %v", err)
+	}
+}
+
+func Test_FeedbackError(t *testing.T) {
+	sim, dev := openSimulator(t)
+	defer dev.Close()
+	sim.SetDigital(u6.FIO0, true)
+
+	fio0 := &u6.FeedbackBitStateRead{BitNumber: u6.FIO0}
+	invalid := invalidIOType{}
+	err := dev.Feedback(fio0, &u6.FeedbackBitStateWrite{BitNumber: u6.FIO1, State: u6.BitStateEnabled}, invalid)
+
+	var ferr *u6.FeedbackError
+	if !errors.As(err, &ferr) {
+		t.Fatalf("Expected FeedbackError; got %v", err)
+	} else if ferr.Index != 2 || ferr.Command != invalid || ferr.IOType != "IOType(127)" || ferr.Code != u6.ErrIOTypeNotValid {
+		t.Fatalf("Invalid FeedbackError: %+v", ferr)
+	} else if len(ferr.Executed) != 2 || len(ferr.Populated) != 2 {
+		t.Fatalf("Invalid completed commands: executed=%d; populated=%d", len(ferr.Executed), len(ferr.Populated))
+	} else if !fio0.GetState() {
+		t.Fatal("FIO0 response was not populated")
+	}
+
+	if _, state := sim.Digital(u6.FIO1); !state {
+		t.Fatal("FIO1 was not written")
+	}
+}
@@ -3,10 +3,24 @@ package u6
 import (
 	"errors"
 	"fmt"
+
+	"github.com/eliquious/labjack"
+	"github.com/eliquious/labjack/frame"
 )
 
-// ErrInvalidContext is returned if the context is nil
-var ErrInvalidContext = errors.New("Invalid USB context")
+// ErrInvalidContext is returned if the context is nil. It is the same error as
+// labjack.ErrInvalidContext.
+var ErrInvalidContext = labjack.ErrInvalidContext
+
+// ErrDeviceNotFound is returned if no matching U6 is attached.
+var ErrDeviceNotFound = errors.New("No matching U6 device found")
+
+// ErrDeviceDisconnected is returned when the U6 was unplugged or lost power.
+var ErrDeviceDisconnected = errors.New("U6 device disconnected")
+
+// ErrReadOnly is returned for output commands when the U6 was opened with
+// WithReadOnly.
+var ErrReadOnly = errors.New("Output commands are refused in read-only mode")
 
 // ErrEndpointSendError is returned when data could not be sent or not all the data was sent.
 var ErrEndpointSendError = errors.New("Failed to send data to device")
@@ -18,19 +32,19 @@ var ErrEndpointRecvError = errors.New("Failed to receive data from device")
 var ErrInvalidChecksumInput = errors.New("Checksum could not be calculated; input too short")
 
 // ErrInvalidChecksumResponse is returned if the U6 detected a bad checksum
-var ErrInvalidChecksumResponse = errors.New("The U6 detected a bad checksum. Double check your checksum calculations and try again")
+var ErrInvalidChecksumResponse = frame.ErrChecksumEcho
 
 // ErrInvalidChecksum8Response is returned if the checksum8 function provides invalid data.
 var ErrInvalidChecksum8Response = errors.New("The U6 detected a bad checksum. Double check your checksum8 calculations and try again")
 
 // ErrInvalidChecksum is returned if the checksum is invalid
-var ErrInvalidChecksum = errors.New("Invalid checksum")
+var ErrInvalidChecksum = frame.ErrChecksum
 
 // ErrInvalidResponseHeader is returned if the response header is not valid.
-var ErrInvalidResponseHeader = errors.New("Invalid response header")
+var ErrInvalidResponseHeader = frame.ErrHeader
 
 // ErrResponseTooShort is returned if the response cannot be validated due to short length.
-var ErrResponseTooShort = errors.New("Response data is too short")
+var ErrResponseTooShort = frame.ErrTooShort
 
 // ErrLibUSB returns when there's a low-level error in gousb.
 type ErrLibUSB struct {
@@ -42,11 +56,41 @@ func (e ErrLibUSB) Error() string {
 	return fmt.Sprintf("%s: %v", e.message, e.err)
 }
 
-// ErrLabJackErrorCode returns when there's an error response from the U6.
-type ErrLabJackErrorCode struct {
-	code int
+// FeedbackError is returned when the U6 reports an error for one of the
+// commands of a Feedback call.
+type FeedbackError struct {
+
+	// Command is the failed command and Index its position in the Feedback
+	// call. Command is nil if the error frame does not match a command.
+	Command FeedbackCommand
+	Index   int
+
+	// IOType is the name of the failed command's IOType.
+	IOType string
+
+	// Code is the error reported by the U6.
+	Code ErrorCode
+
+	// Executed holds the commands before the failed one, which the U6
+	// executed. Populated holds those whose responses were read.
+	Executed  []FeedbackCommand
+	Populated []FeedbackCommand
+}
+
+func newFeedbackError(cmds []FeedbackCommand, ioTypes []byte, index int, code ErrorCode) *FeedbackError {
+	err := &FeedbackError{Index: index, IOType: "unknown", Code: code}
+	if index < len(cmds) {
+		err.Command = cmds[index]
+		err.IOType = ioTypeName(ioTypes[index])
+	}
+	return err
+}
+
+func (e *FeedbackError) Error() string {
+	return fmt.Sprintf("Feedback command %d (%s) failed: %v", e.Index, e.IOType, e.Code)
 }
 
-func (e ErrLabJackErrorCode) Error() string {
-	return fmt.Sprintf("LabJack error code: %v", e.code)
+// Unwrap returns the ErrorCode.
+func (e *FeedbackError) Unwrap() error {
+	return e.Code
 }
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/eliquious/labjack"
+	"github.com/eliquious/labjack/u6"
+	"github.com/google/gousb"
+	"log"
+)
+
+func main() {
+	// Initialize a new Context.
+	ctx := gousb.NewContext()
+	defer ctx.Close()
+
+	// Watch for LabJack devices
+	events, err := labjack.Watch(context.Background(), ctx, 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for event := range events {
+		fmt.Printf("%s: vendor=%s product=%s bus=%d address=%d serial=%q\n",
+			event.Type, event.Vendor, event.Product, event.Bus, event.Address, event.SerialNumber)
+		if event.Type != labjack.DeviceAttached || event.Product != labjack.U6ProductID {
+			continue
+		}
+
+		// Open newly attached U6 devices
+		dev, err := u6.OpenByAddress(ctx, event.Bus, event.Address)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		fmt.Println(dev.DeviceDesc())
+		dev.Close()
+	}
+}
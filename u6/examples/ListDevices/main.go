@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"github.com/eliquious/labjack/u6"
+	"github.com/google/gousb"
+	"log"
+)
+
+func main() {
+	// Initialize a new Context.
+	ctx := gousb.NewContext()
+	defer ctx.Close()
+
+	// List attached U6 devices
+	descs, err := u6.ListDevices(ctx)
+	if err != nil && len(descs) == 0 {
+		log.Fatal(err)
+	} else if err != nil {
+		log.Println(err)
+	}
+	for _, desc := range descs {
+		fmt.Println(desc)
+	}
+	if len(descs) == 0 {
+		return
+	}
+
+	// Open the first U6 by serial number
+	dev, err := u6.OpenBySerialNumber(ctx, descs[0].SerialNumber)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer dev.Close()
+
+	fmt.Println(dev.GetCalibrationInfo())
+}
@@ -2,6 +2,7 @@ package u6
 
 import "io"
 import "errors"
+import "fmt"
 
 // DigitalIOBit represents the FIO, EIO and CIO bits
 type DigitalIOBit byte
@@ -30,6 +31,18 @@ const (
 	CIO3                     // 19
 )
 
+func (b DigitalIOBit) String() string {
+	switch {
+	case b <= FIO7:
+		return fmt.Sprintf("FIO%d", b)
+	case b <= EIO7:
+		return fmt.Sprintf("EIO%d", b-EIO0)
+	case b <= CIO3:
+		return fmt.Sprintf("CIO%d", b-CIO0)
+	}
+	return fmt.Sprintf("DigitalIOBit(%d)", byte(b))
+}
+
 // BitDirection describes the IO direction (read/write)
 type BitDirection byte
 
@@ -48,6 +61,29 @@ const (
 	BitStateEnabled  BitState = 128 // 128
 )
 
+// ioTypeNames names the IOTypes of the Feedback commands.
+var ioTypeNames = map[byte]string{
+	2:  "AIN24",
+	3:  "AIN24AR",
+	10: "BitStateRead",
+	11: "BitStateWrite",
+	12: "BitDirRead",
+	13: "BitDirWrite",
+	26: "PortStateRead",
+	27: "PortStateWrite",
+	28: "PortDirRead",
+	29: "PortDirWrite",
+	38: "DAC0 (16-bit)",
+	39: "DAC1 (16-bit)",
+}
+
+func ioTypeName(ioType byte) string {
+	if name, ok := ioTypeNames[ioType]; ok {
+		return name
+	}
+	return fmt.Sprintf("IOType(%d)", ioType)
+}
+
 // FeedbackCommand writes to and reads from the USB connection.
 type FeedbackCommand interface {
 	WriteTo(w io.Writer) (n int, err error)
@@ -95,6 +131,172 @@ func (f *FeedbackPortDirWrite) ResponseSize() int {
 	return 0
 }
 
+func (f *FeedbackPortDirWrite) applyOutput(o *outputState) {
+	mask := uint32(f.FIOWriteMask) | uint32(f.EIOWriteMask)<<8 | uint32(f.CIOWriteMask&0x0F)<<16
+	dir := uint32(f.FIODirection) | uint32(f.EIODirection)<<8 | uint32(f.CIODirection&0x0F)<<16
+	o.setDirection(mask, dir)
+}
+
+// FeedbackPortStateWrite is the Feedback command for PortStateWrite. Only the
+// lines set in the write masks are written, all at once; see Set.
+type FeedbackPortStateWrite struct {
+	FIOWriteMask byte
+	EIOWriteMask byte
+	CIOWriteMask byte
+	FIOState     byte
+	EIOState     byte
+	CIOState     byte
+}
+
+// Set adds the state of a line to the write. It fails for lines above CIO3.
+func (f *FeedbackPortStateWrite) Set(bit DigitalIOBit, state bool) error {
+	if bit > CIO3 {
+		return fmt.Errorf("Invalid digital line %d", bit)
+	}
+
+	masks := []*byte{&f.FIOWriteMask, &f.EIOWriteMask, &f.CIOWriteMask}
+	states := []*byte{&f.FIOState, &f.EIOState, &f.CIOState}
+
+	port, mask := bit/8, byte(1)<<(bit%8)
+	*masks[port] |= mask
+	if state {
+		*states[port] |= mask
+	} else {
+		*states[port] &^= mask
+	}
+	return nil
+}
+
+// WriteTo writes the PortStateWrite command.
+func (f *FeedbackPortStateWrite) WriteTo(w io.Writer) (int, error) {
+	buf := make([]byte, 7)
+	buf[0] = 27             // IOType for PortStateWrite
+	buf[1] = f.FIOWriteMask //FIO Writemask
+	buf[2] = f.EIOWriteMask //EIO Writemask
+	buf[3] = f.CIOWriteMask //CIO Writemask
+	buf[4] = f.FIOState     //FIO State
+	buf[5] = f.EIOState     //EIO State
+	buf[6] = f.CIOState     //CIO State
+	return w.Write(buf)
+}
+
+// SetCalibrationInfo sets the calibration info for calculating the proper values.
+func (f *FeedbackPortStateWrite) SetCalibrationInfo(info CalibrationInfo) {
+}
+
+// ReadFrom reads the response.
+func (f *FeedbackPortStateWrite) ReadFrom(r io.Reader) (int, error) {
+	return 0, nil
+}
+
+// ResponseSize returns the response size.
+func (f *FeedbackPortStateWrite) ResponseSize() int {
+	return 0
+}
+
+func (f *FeedbackPortStateWrite) applyOutput(o *outputState) {
+	mask := uint32(f.FIOWriteMask) | uint32(f.EIOWriteMask)<<8 | uint32(f.CIOWriteMask&0x0F)<<16
+	state := uint32(f.FIOState) | uint32(f.EIOState)<<8 | uint32(f.CIOState&0x0F)<<16
+	o.setState(mask, state)
+}
+
+// portResponse holds the FIO, EIO and CIO bytes of PortStateRead and
+// PortDirRead.
+type portResponse []byte
+
+func (p *portResponse) read(r io.Reader) (int, error) {
+	*p = make([]byte, 3)
+	return io.ReadFull(r, *p)
+}
+
+func (p portResponse) ports() (fio, eio, cio byte) {
+	if len(p) < 3 {
+		return 0, 0, 0
+	}
+	return p[0], p[1], p[2]
+}
+
+func (p portResponse) bit(bit DigitalIOBit) bool {
+	if len(p) < 3 || bit > CIO3 {
+		return false
+	}
+	return p[bit/8]&(1<<(bit%8)) != 0
+}
+
+// FeedbackPortStateRead is the Feedback command for PortStateRead. It reads
+// the state of all digital lines at once.
+type FeedbackPortStateRead struct {
+	response portResponse
+}
+
+// WriteTo writes the PortStateRead command.
+func (f *FeedbackPortStateRead) WriteTo(w io.Writer) (int, error) {
+	return w.Write([]byte{26}) // IOType for PortStateRead
+}
+
+// SetCalibrationInfo sets the calibration info for calculating the proper values.
+func (f *FeedbackPortStateRead) SetCalibrationInfo(info CalibrationInfo) {
+}
+
+// ReadFrom reads the response.
+func (f *FeedbackPortStateRead) ReadFrom(r io.Reader) (int, error) {
+	return f.response.read(r)
+}
+
+// ResponseSize returns the response size.
+func (f *FeedbackPortStateRead) ResponseSize() int {
+	return 3
+}
+
+// GetPorts returns the FIO, EIO and CIO states as bit masks.
+func (f *FeedbackPortStateRead) GetPorts() (fio, eio, cio byte) {
+	return f.response.ports()
+}
+
+// GetState returns the state of a line.
+func (f *FeedbackPortStateRead) GetState(bit DigitalIOBit) bool {
+	return f.response.bit(bit)
+}
+
+// FeedbackPortDirRead is the Feedback command for PortDirRead. It reads the
+// direction of all digital lines at once.
+type FeedbackPortDirRead struct {
+	response portResponse
+}
+
+// WriteTo writes the PortDirRead command.
+func (f *FeedbackPortDirRead) WriteTo(w io.Writer) (int, error) {
+	return w.Write([]byte{28}) // IOType for PortDirRead
+}
+
+// SetCalibrationInfo sets the calibration info for calculating the proper values.
+func (f *FeedbackPortDirRead) SetCalibrationInfo(info CalibrationInfo) {
+}
+
+// ReadFrom reads the response.
+func (f *FeedbackPortDirRead) ReadFrom(r io.Reader) (int, error) {
+	return f.response.read(r)
+}
+
+// ResponseSize returns the response size.
+func (f *FeedbackPortDirRead) ResponseSize() int {
+	return 3
+}
+
+// GetPorts returns the FIO, EIO and CIO directions as bit masks, where set
+// bits are outputs.
+func (f *FeedbackPortDirRead) GetPorts() (fio, eio, cio byte) {
+	return f.response.ports()
+}
+
+// GetDirection returns the direction of a line.
+func (f *FeedbackPortDirRead) GetDirection(bit DigitalIOBit) BitDirection {
+	if f.response.bit(bit) {
+		return BitDirectionWrite
+	}
+	return BitDirectionRead
+}
+
 // FeedbackAIN24 is the Feedback command for AIN24.
 type FeedbackAIN24 struct {
 	PositiveChannel int
@@ -130,9 +332,8 @@ func (f *FeedbackAIN24) WriteTo(w io.Writer) (int, error) {
 
 // ReadFrom reads the response.
 func (f *FeedbackAIN24) ReadFrom(r io.Reader) (int, error) {
-	f.responseBuffer = make([]byte, 4)
-	n, err := r.Read(f.responseBuffer)
-	return int(n), err
+	f.responseBuffer = make([]byte, 3)
+	return io.ReadFull(r, f.responseBuffer)
 }
 
 // ResponseSize returns the response size.
@@ -147,6 +348,9 @@ func (f *FeedbackAIN24) SetCalibrationInfo(info CalibrationInfo) {
 
 // GetVoltage returns the calibrated voltage
 func (f *FeedbackAIN24) GetVoltage() (float64, error) {
+	if len(f.responseBuffer) < 3 {
+		return 0, ErrResponseTooShort
+	}
 	return getCalibratedAIN(f.calInfo, f.ResolutionIndex, f.GainIndex, true, uint(f.responseBuffer[0])+uint(f.responseBuffer[1])*256+uint(f.responseBuffer[2])*65536)
 }
 
@@ -159,7 +363,7 @@ func getCalibratedAIN(cal CalibrationInfo, ResolutionIndex int, GainIndex int, H
 		value /= 256.0
 	}
 
-	if GainIndex > 4 {
+	if GainIndex < 0 || GainIndex > 3 {
 		return 0, errors.New("Invalid gain index")
 	}
 
@@ -175,6 +379,92 @@ func getCalibratedAIN(cal CalibrationInfo, ResolutionIndex int, GainIndex int, H
 	return analogVolt, nil
 }
 
+// AutoRangeGainIndex is the GainIndex of FeedbackAIN24AR which lets the U6
+// select the gain.
+const AutoRangeGainIndex = 15
+
+// FeedbackAIN24AR is the Feedback command for AIN24AR. The U6 selects the
+// gain when GainIndex is AutoRangeGainIndex and returns the gain it used.
+type FeedbackAIN24AR struct {
+	PositiveChannel int
+	ResolutionIndex int
+	GainIndex       int
+	SettlingFactor  int
+	Differential    bool
+	responseBuffer  []byte
+	calInfo         CalibrationInfo
+}
+
+// WriteTo writes the FeedbackAIN24AR command.
+func (f *FeedbackAIN24AR) WriteTo(w io.Writer) (int, error) {
+	buf := make([]byte, 4)
+	buf[0] = 3                                          // IOType for AIN24AR
+	buf[1] = byte(f.PositiveChannel)                    // Positive Channel
+	buf[2] = byte(uint(f.ResolutionIndex) & 0x0F)       // ResolutionIndex
+	buf[2] = byte((uint(f.GainIndex)&0x0F)<<4) + buf[2] // GainIndex
+	buf[3] = byte(f.SettlingFactor)                     // SettlingFactor
+	if f.Differential {
+		buf[3] += 1 << 7
+	}
+	return w.Write(buf)
+}
+
+// ReadFrom reads the response.
+func (f *FeedbackAIN24AR) ReadFrom(r io.Reader) (int, error) {
+	f.responseBuffer = make([]byte, 5)
+	return io.ReadFull(r, f.responseBuffer)
+}
+
+// ResponseSize returns the response size.
+func (f *FeedbackAIN24AR) ResponseSize() int {
+	return 5
+}
+
+// SetCalibrationInfo sets the calibration info for calculating the proper values.
+func (f *FeedbackAIN24AR) SetCalibrationInfo(info CalibrationInfo) {
+	f.calInfo = info
+}
+
+// GetRaw returns the raw 24-bit reading.
+func (f *FeedbackAIN24AR) GetRaw() uint32 {
+	if len(f.responseBuffer) < 5 {
+		return 0
+	}
+	return uint32(f.responseBuffer[0]) + uint32(f.responseBuffer[1])<<8 + uint32(f.responseBuffer[2])<<16
+}
+
+// GetResolutionIndex returns the resolution index used by the U6.
+func (f *FeedbackAIN24AR) GetResolutionIndex() int {
+	if len(f.responseBuffer) < 5 {
+		return 0
+	}
+	return int(f.responseBuffer[3] & 0x0F)
+}
+
+// GetGainIndex returns the gain index used by the U6.
+func (f *FeedbackAIN24AR) GetGainIndex() int {
+	if len(f.responseBuffer) < 5 {
+		return 0
+	}
+	return int(f.responseBuffer[3] >> 4)
+}
+
+// GetStatus returns the status byte of the reading.
+func (f *FeedbackAIN24AR) GetStatus() byte {
+	if len(f.responseBuffer) < 5 {
+		return 0
+	}
+	return f.responseBuffer[4]
+}
+
+// GetVoltage returns the voltage calibrated for the gain used by the U6.
+func (f *FeedbackAIN24AR) GetVoltage() (float64, error) {
+	if len(f.responseBuffer) < 5 {
+		return 0, ErrResponseTooShort
+	}
+	return getCalibratedAIN(f.calInfo, f.GetResolutionIndex(), f.GetGainIndex(), true, uint(f.GetRaw()))
+}
+
 // FeedbackBitStateRead is the feedback command for BitStateRead
 type FeedbackBitStateRead struct {
 	BitNumber DigitalIOBit
@@ -192,7 +482,7 @@ func (f *FeedbackBitStateRead) WriteTo(w io.Writer) (n int, err error) {
 // ReadFrom reads the response
 func (f *FeedbackBitStateRead) ReadFrom(r io.Reader) (n int, err error) {
 	responseBuffer := make([]byte, 1)
-	n, err = r.Read(responseBuffer)
+	n, err = io.ReadFull(r, responseBuffer)
 	f.state = responseBuffer[0]
 	return n, err
 }
@@ -216,7 +506,6 @@ type FeedbackBitDirWrite struct {
 	BitNumber DigitalIOBit
 	Direction BitDirection
 	calInfo   CalibrationInfo
-	state     byte
 }
 
 // WriteTo writes the command
@@ -229,21 +518,65 @@ func (f *FeedbackBitDirWrite) WriteTo(w io.Writer) (n int, err error) {
 
 // ReadFrom reads the response
 func (f *FeedbackBitDirWrite) ReadFrom(r io.Reader) (n int, err error) {
-	responseBuffer := make([]byte, 1)
-	n, err = r.Read(responseBuffer)
-	f.state = responseBuffer[0]
-	return n, err
+	return 0, nil
 }
 
 // ResponseSize returns the size of the response
 func (f *FeedbackBitDirWrite) ResponseSize() int {
-	return 1
+	return 0
 }
 
 // SetCalibrationInfo sets the CalibrationInfo
 func (f *FeedbackBitDirWrite) SetCalibrationInfo(info CalibrationInfo) {
 }
 
+func (f *FeedbackBitDirWrite) applyOutput(o *outputState) {
+	// Lines above CIO3 do not exist and are not restored.
+	if f.BitNumber > CIO3 {
+		return
+	}
+	o.setDirection(1<<f.BitNumber, uint32(f.Direction>>7)<<f.BitNumber)
+}
+
+// FeedbackBitDirRead is the BitDirRead feedback command
+type FeedbackBitDirRead struct {
+	BitNumber DigitalIOBit
+	direction byte
+}
+
+// WriteTo writes the command
+func (f *FeedbackBitDirRead) WriteTo(w io.Writer) (n int, err error) {
+	buffer := make([]byte, 2)
+	buffer[0] = 12
+	buffer[1] = byte(f.BitNumber)
+	return w.Write(buffer)
+}
+
+// ReadFrom reads the response
+func (f *FeedbackBitDirRead) ReadFrom(r io.Reader) (n int, err error) {
+	responseBuffer := make([]byte, 1)
+	n, err = io.ReadFull(r, responseBuffer)
+	f.direction = responseBuffer[0]
+	return n, err
+}
+
+// ResponseSize is the size of the response
+func (f *FeedbackBitDirRead) ResponseSize() int {
+	return 1
+}
+
+// SetCalibrationInfo sets the CalibrationInfo
+func (f *FeedbackBitDirRead) SetCalibrationInfo(info CalibrationInfo) {
+}
+
+// GetDirection gets the response direction of the bit.
+func (f *FeedbackBitDirRead) GetDirection() BitDirection {
+	if f.direction == 1 {
+		return BitDirectionWrite
+	}
+	return BitDirectionRead
+}
+
 // FeedbackBitStateWrite is the BitStateWrite feedback command
 type FeedbackBitStateWrite struct {
 	BitNumber DigitalIOBit
@@ -271,3 +604,10 @@ func (f *FeedbackBitStateWrite) ResponseSize() int {
 // SetCalibrationInfo sets the CalibrationInfo
 func (f *FeedbackBitStateWrite) SetCalibrationInfo(info CalibrationInfo) {
 }
+
+func (f *FeedbackBitStateWrite) applyOutput(o *outputState) {
+	if f.BitNumber > CIO3 {
+		return
+	}
+	o.setState(1<<f.BitNumber, uint32(f.State>>7)<<f.BitNumber)
+}
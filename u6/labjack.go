@@ -0,0 +1,154 @@
+package u6
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/eliquious/labjack"
+)
+
+// U6 implements the device-agnostic labjack.Device.
+var _ labjack.Device = (*U6)(nil)
+
+// Describe returns the device details.
+func (u *U6) Describe() labjack.DeviceInfo {
+	desc := u.DeviceDesc()
+	return labjack.DeviceInfo{
+		Model:           string(desc.DeviceType),
+		SerialNumber:    desc.SerialNumber,
+		FirmwareVersion: desc.FirmwareVersion,
+		HardwareVersion: desc.HardwareVersion,
+	}
+}
+
+// ReadAnalog reads the analog input channel in volts with the ±10V range.
+func (u *U6) ReadAnalog(ctx context.Context, channel int) (float64, error) {
+	if channel < 0 || channel > 255 {
+		return 0, fmt.Errorf("Invalid analog channel %d", channel)
+	}
+
+	ain := &FeedbackAIN24{PositiveChannel: channel, ResolutionIndex: 8, GainIndex: 0}
+	if err := u.FeedbackContext(ctx, ain); err != nil {
+		return 0, err
+	}
+	return ain.GetVoltage()
+}
+
+// WriteAnalog sets the DAC output channel in volts, see SetDACVoltage.
+func (u *U6) WriteAnalog(ctx context.Context, channel int, volts float64) error {
+	return u.SetDACVoltageContext(ctx, channel, volts)
+}
+
+// ReadDigital reads the digital line without changing its direction, so it
+// is allowed in read-only mode. Lines are numbered as DigitalIOBit.
+func (u *U6) ReadDigital(ctx context.Context, line int) (bool, error) {
+	if line < 0 || line > int(CIO3) {
+		return false, fmt.Errorf("Invalid digital line %d", line)
+	}
+
+	state := &FeedbackBitStateRead{BitNumber: DigitalIOBit(line)}
+	err := u.FeedbackContext(ctx, state)
+	return state.GetState(), err
+}
+
+// WriteDigital configures the digital line as output and sets it. Lines are
+// numbered as DigitalIOBit.
+func (u *U6) WriteDigital(ctx context.Context, line int, state bool) error {
+	if line < 0 || line > int(CIO3) {
+		return fmt.Errorf("Invalid digital line %d", line)
+	}
+
+	bitState := BitStateDisabled
+	if state {
+		bitState = BitStateEnabled
+	}
+	return u.FeedbackContext(ctx,
+		&FeedbackBitDirWrite{BitNumber: DigitalIOBit(line), Direction: BitDirectionWrite},
+		&FeedbackBitStateWrite{BitNumber: DigitalIOBit(line), State: bitState},
+	)
+}
+
+// StartStream streams the channels with the ±10V range. Channels 193 and 194
+// read the FIO/EIO and CIO lines as a bit mask. The stream runs until the
+// context is done, after which the channel is closed.
+func (u *U6) StartStream(ctx context.Context, config labjack.StreamConfig) (<-chan labjack.Scan, error) {
+	if len(config.Channels) == 0 {
+		return nil, errors.New("No stream channels")
+	} else if config.ScanRate < 1 {
+		return nil, errors.New("Invalid scan rate")
+	}
+
+	streamConfig := &StreamConfig{
+		ResolutionIndex:  1,
+		SamplesPerPacket: 25,
+		ScanFrequency:    config.ScanRate,
+		ScanConfig:       &ScanConfig{ClockSpeed: ClockSpeed4Mhz},
+	}
+	for _, channel := range config.Channels {
+		if channel < 0 || channel > 255 {
+			return nil, fmt.Errorf("Invalid stream channel %d", channel)
+		}
+		streamConfig.Channels = append(streamConfig.Channels, ChannelConfig{PositiveChannel: byte(channel)})
+	}
+
+	stream, err := u.NewStreamContext(ctx, streamConfig)
+	if err != nil {
+		return nil, err
+	}
+	data, err := stream.StartContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	scans := make(chan labjack.Scan, cap(data))
+	go func() {
+		defer close(scans)
+		defer stream.Stop()
+
+		send := func(scan labjack.Scan) bool {
+			select {
+			case scans <- scan:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		values := make([]float64, len(config.Channels))
+		for {
+			var resp StreamResponse
+			select {
+			case resp = <-data:
+			case <-ctx.Done():
+				return
+			}
+
+			if resp.Error != nil {
+				if !send(labjack.Scan{Time: resp.Timestamp, Err: resp.Error}) {
+					return
+				}
+				continue
+			}
+
+			for _, sample := range resp.Data {
+				value := float64(sample.Raw)
+				if sample.channelConfig.PositiveChannel < 193 {
+					var err error
+					if value, err = sample.GetCalibratedAIN(); err != nil && !send(labjack.Scan{Time: resp.Timestamp, Err: err}) {
+						return
+					}
+				}
+				values[sample.ChannelIndex] = value
+
+				if sample.ChannelIndex == len(values)-1 {
+					if !send(labjack.Scan{Time: resp.Timestamp, Number: sample.ScanNumber, Values: values}) {
+						return
+					}
+					values = make([]float64, len(config.Channels))
+				}
+			}
+		}
+	}()
+	return scans, nil
+}
@@ -0,0 +1,98 @@
+package u6_test
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/eliquious/labjack"
+	"github.com/eliquious/labjack/u6"
+)
+
+func Test_Device(t *testing.T) {
+	sim, dev := openSimulator(t)
+	defer dev.Close()
+	sim.SetAIN(2, 3.3)
+	sim.SetDigital(u6.FIO4, true)
+
+	var device labjack.Device = dev
+	ctx := context.Background()
+	if info := device.Describe(); info.Model != "U6" || info.SerialNumber != sim.SerialNumber {
+		t.Fatalf("Invalid device info: %+v", info)
+	}
+
+	volts, err := device.ReadAnalog(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	} else if math.Abs(volts-3.3) > 0.01 {
+		t.Fatalf("Invalid voltage: %v", volts)
+	}
+
+	if state, err := device.ReadDigital(ctx, int(u6.FIO4)); err != nil || !state {
+		t.Fatalf("Invalid FIO4 state: %v, %v", state, err)
+	} else if err := device.WriteDigital(ctx, int(u6.EIO2), true); err != nil {
+		t.Fatal(err)
+	} else if dir, state := sim.Digital(u6.EIO2); dir != u6.BitDirectionWrite || !state {
+		t.Fatalf("EIO2 was not written: %v, %v", dir, state)
+	} else if state, err := device.ReadDigital(ctx, int(u6.EIO2)); err != nil || !state {
+		t.Fatalf("Invalid EIO2 state: %v, %v", state, err)
+	} else if dir, _ := sim.Digital(u6.EIO2); dir != u6.BitDirectionWrite {
+		t.Fatal("Reading EIO2 changed its direction")
+	} else if _, err := device.ReadDigital(ctx, 20); err == nil {
+		t.Fatal("Expected error for invalid line")
+	}
+
+	if err := device.WriteAnalog(ctx, 1, 2.5); err != nil {
+		t.Fatal(err)
+	} else if volts := sim.DAC(1); math.Abs(volts-2.5) > 0.001 {
+		t.Fatalf("DAC1 was not written: %v", volts)
+	} else if err := device.WriteAnalog(ctx, 2, 1.0); err == nil {
+		t.Fatal("Expected error for invalid DAC")
+	}
+}
+
+func Test_DeviceStream(t *testing.T) {
+	sim, dev := openSimulator(t)
+	defer dev.Close()
+	sim.SetAIN(0, 1.5)
+	sim.SetDigital(u6.FIO1, true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	scans, err := dev.StartStream(ctx, labjack.StreamConfig{Channels: []int{0, 193}, ScanRate: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case scan := <-scans:
+		if scan.Err != nil {
+			t.Fatal(scan.Err)
+		} else if len(scan.Values) != 2 || math.Abs(scan.Values[0]-1.5) > 0.01 || scan.Values[1] != 2 {
+			t.Fatalf("Invalid scan: %+v", scan)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("No scans")
+	}
+
+	cancel()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-scans:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("Stream was not closed")
+		}
+	}
+}
+
+func Test_ErrInvalidContext(t *testing.T) {
+	if _, err := u6.ListDevices(nil); err != labjack.ErrInvalidContext {
+		t.Fatalf("Expected labjack.ErrInvalidContext; got %v", err)
+	} else if _, err := labjack.Watch(context.Background(), nil, 0); err != u6.ErrInvalidContext {
+		t.Fatalf("Expected u6.ErrInvalidContext; got %v", err)
+	}
+}
@@ -0,0 +1,22 @@
+package u6
+
+import "testing"
+
+func TestOutputStateBits(t *testing.T) {
+	var o outputState
+	for _, cmd := range []outputCommand{
+		&FeedbackBitStateWrite{BitNumber: CIO3, State: BitStateEnabled},
+		&FeedbackBitDirWrite{BitNumber: CIO3, Direction: BitDirectionWrite},
+		&FeedbackBitStateWrite{BitNumber: CIO3 + 1, State: BitStateEnabled},
+		&FeedbackBitDirWrite{BitNumber: 40, Direction: BitDirectionWrite},
+	} {
+		cmd.applyOutput(&o)
+	}
+
+	if o.stateMask != 1<<CIO3 || o.state != 1<<CIO3 {
+		t.Errorf("Invalid state: mask=%#x; state=%#x", o.stateMask, o.state)
+	}
+	if o.dirMask != 1<<CIO3 || o.dir != 1<<CIO3 {
+		t.Errorf("Invalid direction: mask=%#x; dir=%#x", o.dirMask, o.dir)
+	}
+}
@@ -0,0 +1,212 @@
+package u6
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+// Hand-built U6 responses used as test vectors. They follow the response
+// layouts of the U6 User's Guide, with valid checksums, but are not captures
+// of a device.
+var (
+
+	// ConfigU6 response of a U6-Pro with firmware 1.45, serial number 360012345.
+	configU6Response = []byte{
+		0x76, 0xF8, 0x10, 0x08, 0x64, 0x01, 0x00, 0x00, 0x00, 0x2D, 0x01, 0x00, 0x04, 0x00, 0x02, 0x39,
+		0x5A, 0x75, 0x15, 0x06, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x0C,
+	}
+
+	// Feedback response to AIN24 (AIN0, ResolutionIndex 8, GainIndex 0)
+	// followed by BitStateRead with the echo 0x2A.
+	feedbackResponse = []byte{
+		0x1F, 0xF8, 0x04, 0x00, 0x21, 0x01, 0x00, 0x00, 0x2A, 0x00, 0x64, 0x92, 0x01, 0x00,
+	}
+
+	// Stream data packet 7 of two samples with a backlog of 3 packets.
+	streamDataPacket = []byte{
+		0x74, 0xF9, 0x06, 0xC0, 0xB3, 0x00, 0x00, 0x00, 0x00, 0x00, 0x07, 0x00, 0x23, 0x81, 0x05, 0x00,
+		0x03, 0x00,
+	}
+
+	// Stream data packet ending an auto-recovery after 300 dropped scans.
+	streamRecoveryPacket = []byte{
+		0x32, 0xF9, 0x06, 0xC0, 0x71, 0x00, 0x2C, 0x01, 0x00, 0x00, 0x08, 0x3C, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00,
+	}
+)
+
+func TestParseConfigBytes(t *testing.T) {
+	if _, err := parseExtended(configU6Response, len(configU6Response), 0x08); err != nil {
+		t.Fatal(err)
+	}
+
+	desc, err := parseConfigBytes(configU6Response)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := DeviceDesc{
+		FirmwareVersion:   "1.45",
+		BootloaderVersion: "4.00",
+		HardwareVersion:   "2.00",
+		SerialNumber:      360012345,
+		ProductID:         6,
+		LocalID:           1,
+		VersionInfo:       12,
+		DeviceType:        U6ProDevice,
+	}
+	if desc != expected {
+		t.Fatalf("Invalid device desc: %v != %v", desc, expected)
+	}
+
+	if _, err := parseConfigBytes(configU6Response[:37]); err == nil {
+		t.Fatal("Expected error for short response")
+	}
+}
+
+func TestFeedbackResponse(t *testing.T) {
+	resp, err := parseExtended(feedbackResponse, len(feedbackResponse), 0x00)
+	if err != nil {
+		t.Fatal(err)
+	} else if resp.Data[2] != 0x2A {
+		t.Fatalf("Invalid echo: %d", resp.Data[2])
+	}
+
+	ain := &FeedbackAIN24{ResolutionIndex: 8}
+	ain.SetCalibrationInfo(DefaultCalibrationInfo)
+	state := &FeedbackBitStateRead{BitNumber: FIO0}
+	if _, err := populate([]FeedbackCommand{ain, state}, resp.Data[3:]); err != nil {
+		t.Fatal(err)
+	}
+
+	voltage, err := ain.GetVoltage()
+	if err != nil {
+		t.Fatal(err)
+	} else if math.Abs(voltage-1.24838024834) > 1e-9 {
+		t.Fatalf("Invalid voltage: %v", voltage)
+	} else if !state.GetState() {
+		t.Fatal("Invalid bit state")
+	}
+
+	if _, err := populate([]FeedbackCommand{ain, state}, resp.Data[3:6]); err != ErrResponseTooShort {
+		t.Fatalf("Expected ErrResponseTooShort; got %v", err)
+	}
+	if _, err := (&FeedbackAIN24{}).GetVoltage(); err != ErrResponseTooShort {
+		t.Fatalf("Expected ErrResponseTooShort; got %v", err)
+	}
+}
+
+func TestParseStreamPacket(t *testing.T) {
+	packet, err := parseStreamPacket(streamDataPacket, 2)
+	if err != nil {
+		t.Fatal(err)
+	} else if packet.PacketNumber != 7 || packet.ErrorCode != 0 || packet.Backlog != 3 || packet.Dropped != 0 {
+		t.Fatalf("Invalid packet: %+v", packet)
+	} else if len(packet.Samples) != 2 || packet.Samples[0] != 0x8123 || packet.Samples[1] != 5 {
+		t.Fatalf("Invalid samples: %v", packet.Samples)
+	}
+
+	packet, err = parseStreamPacket(streamRecoveryPacket, 2)
+	if err != nil {
+		t.Fatal(err)
+	} else if packet.ErrorCode != ErrStreamAutoRecoverReport || packet.Dropped != 300 {
+		t.Fatalf("Invalid packet: %+v", packet)
+	}
+
+	if _, err := parseStreamPacket(streamDataPacket, 3); err != ErrResponseTooShort {
+		t.Fatalf("Expected ErrResponseTooShort; got %v", err)
+	}
+
+	corrupt := append([]byte(nil), streamDataPacket...)
+	corrupt[12]++
+	if _, err := parseStreamPacket(corrupt, 2); err != ErrInvalidChecksum {
+		t.Fatalf("Expected ErrInvalidChecksum; got %v", err)
+	}
+}
+
+func FuzzParseConfigBytes(f *testing.F) {
+	f.Add(configU6Response)
+	f.Add(configU6Response[:10])
+	f.Fuzz(func(t *testing.T, p []byte) {
+		if _, err := parseConfigBytes(p); err != nil && len(p) >= 38 {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	})
+}
+
+func FuzzFeedbackResponse(f *testing.F) {
+	f.Add(feedbackResponse[9:], 8, 0)
+	f.Add([]byte{0xFF, 0xFF}, 12, 3)
+	f.Fuzz(func(t *testing.T, data []byte, resolutionIndex, gainIndex int) {
+		ain := &FeedbackAIN24{ResolutionIndex: resolutionIndex, GainIndex: gainIndex}
+		ain.SetCalibrationInfo(DefaultCalibrationInfo)
+		state := &FeedbackBitStateRead{}
+
+		if _, err := populate([]FeedbackCommand{ain, state}, data); err != nil {
+			if len(data) >= 4 {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			return
+		}
+
+		voltage, err := ain.GetVoltage()
+		if err == nil && (math.IsNaN(voltage) || math.Abs(voltage) > 100) {
+			t.Fatalf("Invalid voltage: %v", voltage)
+		} else if err != nil && gainIndex >= 0 && gainIndex <= 3 {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	})
+}
+
+func FuzzParseStreamPacket(f *testing.F) {
+	f.Add(streamDataPacket, 2)
+	f.Add(streamRecoveryPacket, 2)
+	f.Add(streamDataPacket[:12], 0)
+	f.Add(streamDataPacket, -1)
+	f.Add(streamDataPacket, 1<<40)
+	f.Fuzz(func(t *testing.T, p []byte, samplesPerPacket int) {
+		packet, err := parseStreamPacket(p, samplesPerPacket)
+		if samplesPerPacket < 1 || samplesPerPacket > 25 {
+			if err == nil {
+				t.Fatalf("Expected error for %d samples per packet", samplesPerPacket)
+			}
+			return
+		} else if err != nil {
+			return
+		} else if len(packet.Samples) != samplesPerPacket {
+			t.Fatalf("Invalid number of samples: %d", len(packet.Samples))
+		} else if !bytes.Equal(p[12:12+2*samplesPerPacket], samplesBytes(packet.Samples)) {
+			t.Fatalf("Samples do not match packet: %v", packet.Samples)
+		}
+	})
+}
+
+func samplesBytes(samples []uint16) []byte {
+	p := make([]byte, 0, 2*len(samples))
+	for _, s := range samples {
+		p = append(p, byte(s), byte(s>>8))
+	}
+	return p
+}
+
+// BitDirWrite and BitStateWrite have no response bytes, so the state of a
+// following BitStateRead is the first byte of the response.
+func TestFeedbackWriteResponse(t *testing.T) {
+	dir := &FeedbackBitDirWrite{BitNumber: FIO0, Direction: BitDirectionWrite}
+	write := &FeedbackBitStateWrite{BitNumber: FIO0, State: BitStateEnabled}
+	state := &FeedbackBitStateRead{BitNumber: FIO0}
+	if dir.ResponseSize() != 0 || write.ResponseSize() != 0 {
+		t.Fatalf("Invalid response sizes: BitDirWrite=%d BitStateWrite=%d", dir.ResponseSize(), write.ResponseSize())
+	}
+
+	remaining, err := populate([]FeedbackCommand{dir, write, state}, []byte{0x01})
+	if err != nil {
+		t.Fatal(err)
+	} else if remaining != 0 {
+		t.Fatalf("Invalid remaining bytes: %d", remaining)
+	} else if !state.GetState() {
+		t.Fatal("Invalid bit state")
+	}
+}
@@ -0,0 +1,96 @@
+package u6
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// RetryPolicy controls the timeouts and retries of command/response
+// transactions. It applies to ConfigU6, ReadCal, Feedback and the stream
+// control commands.
+type RetryPolicy struct {
+
+	// WriteTimeout bounds sending a command. Zero means no timeout.
+	WriteTimeout time.Duration
+
+	// ReadTimeout bounds reading a response. Zero means no timeout.
+	ReadTimeout time.Duration
+
+	// MaxRetries is the number of times a failed transaction is retried.
+	MaxRetries int
+
+	// Backoff is the delay before the first retry. It doubles with every retry.
+	Backoff time.Duration
+
+	// Retryable reports whether a failed transaction is retried. If nil,
+	// IsRetryable is used, except for Feedback commands which change outputs:
+	// those are only retried if the U6 rejected them before executing them,
+	// see IsRetryableOutput, so that an output is not written twice.
+	Retryable func(err error) bool
+}
+
+// DefaultRetryPolicy is the retry policy of a newly opened U6.
+var DefaultRetryPolicy = RetryPolicy{
+	WriteTimeout: time.Second,
+	ReadTimeout:  time.Second,
+	MaxRetries:   2,
+	Backoff:      5 * time.Millisecond,
+}
+
+func (p RetryPolicy) retryable(err error, output bool) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	} else if output {
+		return IsRetryableOutput(err)
+	}
+	return IsRetryable(err)
+}
+
+// IsRetryableOutput reports whether a failed command which changes outputs may
+// be repeated. Only the bad checksum echo (0xB8) is returned before the U6
+// executes a command; after any other error the outputs may have been
+// written already.
+func IsRetryableOutput(err error) bool {
+	return errors.Is(err, ErrInvalidChecksumResponse) ||
+		errors.Is(err, ErrInvalidChecksum8Response)
+}
+
+// IsRetryable reports whether the error comes from a corrupted or lost
+// transfer, such as the bad checksum echo (0xB8) from the U6, or is a
+// transient ErrorCode, so that repeating the command may succeed.
+func IsRetryable(err error) bool {
+	var code ErrorCode
+	if errors.As(err, &code) {
+		return code.Transient()
+	}
+	return errors.Is(err, ErrInvalidChecksumResponse) ||
+		errors.Is(err, ErrInvalidChecksum8Response) ||
+		errors.Is(err, ErrInvalidChecksum) ||
+		errors.Is(err, ErrInvalidResponseHeader) ||
+		errors.Is(err, ErrResponseTooShort) ||
+		errors.Is(err, ErrEndpointRecvError) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+// SetRetryPolicy sets the timeouts and retries of command transactions.
+func (u *U6) SetRetryPolicy(policy RetryPolicy) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.policy = policy
+}
+
+// RetryPolicy returns the current retry policy.
+func (u *U6) RetryPolicy() RetryPolicy {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.policy
+}
+
+// withTimeout returns a context with the timeout applied if it is non-zero.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,332 @@
+package u6
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ConnectionEventType identifies a connection state transition.
+type ConnectionEventType int
+
+const (
+
+	// EventDisconnected is reported when the U6 stopped responding.
+	EventDisconnected ConnectionEventType = iota
+
+	// EventReconnected is reported when the U6 was reopened and its
+	// configuration and calibration were read again.
+	EventReconnected
+
+	// EventRestored is reported when the last-known outputs were re-applied.
+	EventRestored
+
+	// EventStreamResumed is reported when a running stream was restarted.
+	EventStreamResumed
+
+	// EventRestoreFailed is reported when the outputs could not be re-applied
+	// or a stream could not be restarted. The event's Err holds the cause.
+	EventRestoreFailed
+)
+
+func (t ConnectionEventType) String() string {
+	switch t {
+	case EventDisconnected:
+		return "Disconnected"
+	case EventReconnected:
+		return "Reconnected"
+	case EventRestored:
+		return "Restored"
+	case EventStreamResumed:
+		return "StreamResumed"
+	case EventRestoreFailed:
+		return "RestoreFailed"
+	}
+	return fmt.Sprintf("ConnectionEventType(%d)", int(t))
+}
+
+// ConnectionEvent reports a connection state transition.
+type ConnectionEvent struct {
+	Type ConnectionEventType
+	Time time.Time
+	Err  error
+}
+
+// DefaultReconnectInterval is the delay between attempts to reopen a
+// disconnected U6 if the ReconnectConfig does not set one.
+const DefaultReconnectInterval = 500 * time.Millisecond
+
+// ReconnectConfig enables automatic reconnection of a U6.
+type ReconnectConfig struct {
+
+	// Reopen opens a new transport to the same device. USBReopener reopens a
+	// U6 by serial number.
+	Reopen func(ctx context.Context) (Transport, error)
+
+	// Interval is the delay between attempts to reopen the device.
+	Interval time.Duration
+
+	// Events receives the connection events. Events are dropped if the
+	// channel is not ready.
+	Events chan<- ConnectionEvent
+}
+
+// SetReconnect enables the resilient mode, or disables it if config is nil.
+//
+// When a command or a running stream finds the device disconnected, the
+// transport is closed and reopened with config.Reopen until the device
+// returns. The configuration and calibration are then read again, the
+// last-known digital directions and states and the DAC outputs are
+// re-applied and running streams are restarted. Timers and counters are not
+// restored; configure them again after EventRestored. Commands issued
+// meanwhile wait for the reconnection and are then retried; use a context to
+// bound the wait.
+func (u *U6) SetReconnect(config *ReconnectConfig) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if config != nil {
+		c := *config
+		if c.Interval <= 0 {
+			c.Interval = DefaultReconnectInterval
+		}
+		config = &c
+	}
+	u.reconnect = config
+}
+
+func (u *U6) reconnectEnabled() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.reconnect != nil
+}
+
+// reconnectInterval returns the delay between reconnect attempts.
+func (u *U6) reconnectInterval() time.Duration {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.reconnect == nil {
+		return DefaultReconnectInterval
+	}
+	return u.reconnect.Interval
+}
+
+// noReconnectKey marks a context whose commands must not wait for a reconnection.
+type noReconnectKey struct{}
+
+func withoutReconnect(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noReconnectKey{}, true)
+}
+
+// connection returns the generation of the current transport.
+func (u *U6) connection() int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.generation
+}
+
+// recover reconnects after a disconnect seen on connection gen. It reports
+// whether the device is connected again, either by this call or by another
+// goroutine.
+func (u *U6) recover(ctx context.Context, gen int) bool {
+	u.mu.Lock()
+	config := u.reconnect
+	u.mu.Unlock()
+	if config == nil || ctx.Value(noReconnectKey{}) != nil {
+		return false
+	}
+
+	// Only one goroutine reconnects, the others wait for it.
+	select {
+	case u.reconnecting <- struct{}{}:
+		defer func() { <-u.reconnecting }()
+	case <-ctx.Done():
+		return false
+	}
+
+	// The transport is closed once no transaction is using it
+	u.pipe.Lock()
+	u.mu.Lock()
+	if u.generation != gen && !u.lost {
+		u.mu.Unlock()
+		u.pipe.Unlock()
+		return true
+	}
+	if !u.lost {
+		u.lost = true
+		u.unread = false
+		u.transport.Close()
+		u.mu.Unlock()
+		u.pipe.Unlock()
+		u.emit(config, EventDisconnected, nil)
+	} else {
+		u.mu.Unlock()
+		u.pipe.Unlock()
+	}
+
+	for {
+		if !u.reconnectEnabled() {
+			return false
+		} else if u.reopen(ctx, config) == nil {
+			return true
+		}
+
+		timer := time.NewTimer(config.Interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+	}
+}
+
+// reopen opens a new transport, checks that it is the same device and
+// restores the outputs and streams.
+func (u *U6) reopen(ctx context.Context, config *ReconnectConfig) error {
+	t, err := config.Reopen(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Initialize the new connection aside so the U6 stays disconnected
+	// until it is known to be the same device.
+	dev := &U6{transport: t, calibration: DefaultCalibrationInfo, policy: u.RetryPolicy()}
+	if err := dev.initConnection(ctx); err != nil {
+		t.Close()
+		return err
+	}
+	if cal := u.options.calibration; cal != nil {
+		dev.calibration = *cal
+	} else if err := dev.getCalibrationInfo(ctx); err != nil {
+		t.Close()
+		return err
+	}
+	if l, ok := t.(interface{ location() (int, int) }); ok {
+		dev.config.Bus, dev.config.Address = l.location()
+	}
+
+	u.mu.Lock()
+	if u.reconnect == nil {
+		// Closed or disabled meanwhile
+		u.mu.Unlock()
+		t.Close()
+		return ErrDeviceDisconnected
+	} else if dev.config.SerialNumber != u.config.SerialNumber {
+		u.mu.Unlock()
+		t.Close()
+		return ErrDeviceNotFound
+	}
+	u.transport = t
+	u.config = dev.config
+	u.calibration = dev.calibration
+	u.generation++
+	u.lost = false
+	outputs := u.outputs.commands()
+	streams := make([]*Stream, 0, len(u.streams))
+	for s := range u.streams {
+		streams = append(streams, s)
+	}
+	u.mu.Unlock()
+	u.emit(config, EventReconnected, nil)
+
+	rctx := withoutReconnect(ctx)
+	if len(outputs) > 0 {
+		if err := u.FeedbackContext(rctx, outputs...); err != nil {
+			u.emit(config, EventRestoreFailed, err)
+		} else {
+			u.emit(config, EventRestored, nil)
+		}
+	}
+
+	for _, s := range streams {
+		if err := s.resume(rctx); err != nil {
+			u.emit(config, EventRestoreFailed, err)
+		} else {
+			u.emit(config, EventStreamResumed, nil)
+		}
+	}
+	return nil
+}
+
+func (u *U6) emit(config *ReconnectConfig, typ ConnectionEventType, err error) {
+	if err != nil {
+		u.log().Warn("Connection "+typ.String(), "serial", u.DeviceDesc().SerialNumber, "error", err)
+	} else {
+		u.log().Info("Connection "+typ.String(), "serial", u.DeviceDesc().SerialNumber)
+	}
+
+	if config.Events == nil {
+		return
+	}
+
+	select {
+	case config.Events <- ConnectionEvent{Type: typ, Time: time.Now(), Err: err}:
+	default:
+	}
+}
+
+// outputState is the last-known output state of a U6, re-applied after a
+// reconnect.
+type outputState struct {
+	dirMask   uint32
+	dir       uint32
+	stateMask uint32
+	state     uint32
+	dacMask   byte
+	dac       [2]uint16
+}
+
+// outputCommand is implemented by Feedback commands which change output state.
+type outputCommand interface {
+	applyOutput(o *outputState)
+}
+
+func (o *outputState) setDirection(mask, dir uint32) {
+	o.dirMask |= mask
+	o.dir = o.dir&^mask | dir&mask
+}
+
+func (o *outputState) setState(mask, state uint32) {
+	o.stateMask |= mask
+	o.state = o.state&^mask | state&mask
+}
+
+func (o *outputState) setDAC(dac int, value uint16) {
+	o.dacMask |= 1 << dac
+	o.dac[dac] = value
+}
+
+// commands returns the Feedback commands which restore the outputs. States
+// are written before directions so lines switched to output start in their
+// last state.
+func (o outputState) commands() []FeedbackCommand {
+	var cmds []FeedbackCommand
+	if o.stateMask != 0 {
+		cmds = append(cmds, &FeedbackPortStateWrite{
+			FIOWriteMask: byte(o.stateMask),
+			EIOWriteMask: byte(o.stateMask >> 8),
+			CIOWriteMask: byte(o.stateMask >> 16),
+			FIOState:     byte(o.state),
+			EIOState:     byte(o.state >> 8),
+			CIOState:     byte(o.state >> 16),
+		})
+	}
+
+	if o.dirMask != 0 {
+		cmds = append(cmds, &FeedbackPortDirWrite{
+			FIOWriteMask: byte(o.dirMask),
+			EIOWriteMask: byte(o.dirMask >> 8),
+			CIOWriteMask: byte(o.dirMask >> 16),
+			FIODirection: byte(o.dir),
+			EIODirection: byte(o.dir >> 8),
+			CIODirection: byte(o.dir >> 16),
+		})
+	}
+	for dac := range o.dac {
+		if o.dacMask&(1<<dac) != 0 {
+			cmds = append(cmds, &FeedbackDAC16{DAC: dac, Value: o.dac[dac]})
+		}
+	}
+	return cmds
+}
@@ -0,0 +1,184 @@
+package u6_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eliquious/labjack/u6"
+)
+
+func expectEvent(t *testing.T, events chan u6.ConnectionEvent, expected u6.ConnectionEventType) {
+	t.Helper()
+
+	select {
+	case event := <-events:
+		if event.Type != expected {
+			t.Fatalf("Expected %v event; got %v (%v)", expected, event.Type, event.Err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Timed out waiting for %v event", expected)
+	}
+}
+
+func Test_Reconnect(t *testing.T) {
+	sim, dev := openSimulator(t)
+	defer dev.Close()
+
+	plugged := make(chan struct{})
+	events := make(chan u6.ConnectionEvent, 16)
+	dev.SetReconnect(&u6.ReconnectConfig{
+		Reopen: func(ctx context.Context) (u6.Transport, error) {
+			select {
+			case <-plugged:
+				return sim, nil
+			default:
+				return nil, u6.ErrDeviceNotFound
+			}
+		},
+		Interval: 5 * time.Millisecond,
+		Events:   events,
+	})
+
+	err := dev.Feedback(
+		&u6.FeedbackBitStateWrite{BitNumber: u6.FIO2, State: u6.BitStateEnabled},
+		&u6.FeedbackBitDirWrite{BitNumber: u6.FIO2, Direction: u6.BitDirectionWrite},
+		&u6.FeedbackDAC16{DAC: 0, Value: 33000},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err := dev.NewStream(&u6.StreamConfig{1, 2, 0, 1000, &u6.ScanConfig{u6.ClockSpeed4Mhz, u6.ClockDivisionOff, 0}, []u6.ChannelConfig{
+		{193, u6.GainIndex1, u6.DifferentialInputDisabled},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch, err := stream.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Stop()
+
+	// Wait for FIO3 in the stream data
+	resumed := make(chan struct{})
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case resp := <-ch:
+				if resp.Error == nil && len(resp.Data) > 0 && resp.Data[0].FIO(3) == 1 {
+					close(resumed)
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	sim.Unplug()
+	expectEvent(t, events, u6.EventDisconnected)
+
+	// Commands fail while the device is gone
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := dev.FeedbackContext(ctx, &u6.FeedbackBitStateRead{BitNumber: u6.FIO2}); err == nil {
+		t.Fatal("Expected error while disconnected")
+	}
+
+	sim.Plug()
+	close(plugged)
+	expectEvent(t, events, u6.EventReconnected)
+	expectEvent(t, events, u6.EventRestored)
+	expectEvent(t, events, u6.EventStreamResumed)
+
+	if dir, state := sim.Digital(u6.FIO2); dir != u6.BitDirectionWrite || !state {
+		t.Fatalf("FIO2 was not restored: direction=%d; state=%v", dir, state)
+	} else if volts := sim.DAC(0); volts != 2.5 {
+		t.Fatalf("DAC0 was not restored: %v", volts)
+	}
+
+	sim.SetDigital(u6.FIO3, true)
+	select {
+	case <-resumed:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Timed out waiting for stream data")
+	}
+
+	fio3 := &u6.FeedbackBitStateRead{BitNumber: u6.FIO3}
+	if err := dev.Feedback(fio3); err != nil {
+		t.Fatal(err)
+	} else if !fio3.GetState() {
+		t.Fatal("Invalid state: FIO3=false")
+	}
+}
+
+// failingStream fails to open the stream pipe a number of times.
+type failingStream struct {
+	*u6.Simulator
+	failures int32
+}
+
+var errStreamPipe = errors.New("stream pipe unavailable")
+
+func (f *failingStream) OpenStream(transferSize int) (u6.StreamReader, error) {
+	if atomic.AddInt32(&f.failures, -1) >= 0 {
+		return nil, errStreamPipe
+	}
+	return f.Simulator.OpenStream(transferSize)
+}
+
+func Test_ReconnectStreamOpenFails(t *testing.T) {
+	sim, dev := openSimulator(t)
+	defer dev.Close()
+
+	events := make(chan u6.ConnectionEvent, 16)
+	dev.SetReconnect(&u6.ReconnectConfig{
+		Reopen: func(ctx context.Context) (u6.Transport, error) {
+			return &failingStream{Simulator: sim, failures: 2}, nil
+		},
+		Interval: 5 * time.Millisecond,
+		Events:   events,
+	})
+
+	stream, err := dev.NewStream(&u6.StreamConfig{1, 2, 0, 1000, &u6.ScanConfig{u6.ClockSpeed4Mhz, u6.ClockDivisionOff, 0}, []u6.ChannelConfig{
+		{193, u6.GainIndex1, u6.DifferentialInputDisabled},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch, err := stream.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Stop()
+
+	sim.Unplug()
+	expectEvent(t, events, u6.EventDisconnected)
+	sim.Plug()
+
+	// Both failures are reported before the stream resumes
+	var failures int
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case resp := <-ch:
+			if errors.Is(resp.Error, errStreamPipe) {
+				failures++
+			} else if resp.Error == nil && len(resp.Data) > 0 {
+				if failures != 2 {
+					t.Fatalf("Expected 2 stream pipe errors; got %d", failures)
+				}
+				return
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for stream data; %d stream pipe errors", failures)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package u6
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrReplayExhausted is returned when a replay has no more recorded packets for a pipe.
+var ErrReplayExhausted = errors.New("Replay has no more recorded packets")
+
+// Pipe names the USB pipe a packet travelled on.
+type Pipe string
+
+const (
+
+	// PipeCommand is the command pipe (EP1).
+	PipeCommand = Pipe("EP1")
+
+	// PipeResponse is the response pipe (EP2).
+	PipeResponse = Pipe("EP2")
+
+	// PipeStream is the stream pipe (EP3).
+	PipeStream = Pipe("EP3")
+)
+
+// Packet is a single recorded transfer.
+type Packet struct {
+	Time  time.Time
+	Pipe  Pipe
+	Data  []byte
+	Error string
+}
+
+type jsonPacket struct {
+	Time  time.Time `json:"time"`
+	Pipe  Pipe      `json:"pipe"`
+	Data  string    `json:"data"`
+	Error string    `json:"error,omitempty"`
+}
+
+// MarshalJSON encodes the packet with the data as hex.
+func (p Packet) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonPacket{p.Time, p.Pipe, hex.EncodeToString(p.Data), p.Error})
+}
+
+// UnmarshalJSON decodes the packet.
+func (p *Packet) UnmarshalJSON(b []byte) error {
+	var jp jsonPacket
+	if err := json.Unmarshal(b, &jp); err != nil {
+		return err
+	}
+
+	data, err := hex.DecodeString(jp.Data)
+	if err != nil {
+		return err
+	}
+	*p = Packet{jp.Time, jp.Pipe, data, jp.Error}
+	return nil
+}
+
+// ErrReplayMismatch is returned when a replayed command differs from the recording.
+type ErrReplayMismatch struct {
+	Expected []byte
+	Actual   []byte
+}
+
+func (e ErrReplayMismatch) Error() string {
+	return fmt.Sprintf("Replay command mismatch: expected % x; got % x", e.Expected, e.Actual)
+}
+
+// Recorder is a Transport which records every packet sent to and received
+// from the wrapped Transport. Packets are written as one JSON object per line.
+type Recorder struct {
+	transport Transport
+	mu        sync.Mutex
+	enc       *json.Encoder
+}
+
+// NewRecorder records the traffic of t to w.
+func NewRecorder(t Transport, w io.Writer) *Recorder {
+	return &Recorder{transport: t, enc: json.NewEncoder(w)}
+}
+
+func (r *Recorder) record(pipe Pipe, data []byte, err error) {
+	packet := Packet{Time: time.Now(), Pipe: pipe, Data: append([]byte(nil), data...)}
+	if err != nil {
+		packet.Error = err.Error()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.enc.Encode(packet)
+}
+
+// Write sends and records a command packet.
+func (r *Recorder) Write(ctx context.Context, p []byte) (int, error) {
+	n, err := r.transport.Write(ctx, p)
+	r.record(PipeCommand, p[:n], err)
+	return n, err
+}
+
+// Read reads and records a response packet.
+func (r *Recorder) Read(ctx context.Context, p []byte) (int, error) {
+	n, err := r.transport.Read(ctx, p)
+	r.record(PipeResponse, p[:n], err)
+	return n, err
+}
+
+// OpenStream opens the stream pipe and records each read.
+func (r *Recorder) OpenStream(transferSize int) (StreamReader, error) {
+	stream, err := r.transport.OpenStream(transferSize)
+	if err != nil {
+		return nil, err
+	}
+	return &recordedStream{stream, r}, nil
+}
+
+// Close closes the wrapped transport.
+func (r *Recorder) Close() error {
+	return r.transport.Close()
+}
+
+type recordedStream struct {
+	StreamReader
+	recorder *Recorder
+}
+
+func (s *recordedStream) Read(ctx context.Context, p []byte) (int, error) {
+	n, err := s.StreamReader.Read(ctx, p)
+	s.recorder.record(PipeStream, p[:n], err)
+	return n, err
+}
+
+// Replay is a Transport which serves a recording made by a Recorder. Commands
+// written to the replay must match the recorded commands.
+type Replay struct {
+	mu      sync.Mutex
+	packets map[Pipe][]Packet
+}
+
+// NewReplay reads a recording.
+func NewReplay(r io.Reader) (*Replay, error) {
+	replay := &Replay{packets: make(map[Pipe][]Packet)}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var packet Packet
+		if err := json.Unmarshal(scanner.Bytes(), &packet); err != nil {
+			return nil, err
+		}
+		replay.packets[packet.Pipe] = append(replay.packets[packet.Pipe], packet)
+	}
+	return replay, scanner.Err()
+}
+
+func (r *Replay) next(pipe Pipe) (Packet, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	packets := r.packets[pipe]
+	if len(packets) == 0 {
+		return Packet{}, ErrReplayExhausted
+	}
+	r.packets[pipe] = packets[1:]
+	return packets[0], nil
+}
+
+// replayErrors are the sentinel errors restored when replaying a recording, so
+// that the replayed session takes the same retry and reconnect paths.
+var replayErrors = []error{
+	ErrDeviceDisconnected,
+	ErrEndpointSendError,
+	ErrEndpointRecvError,
+	ErrInvalidChecksumResponse,
+	ErrInvalidChecksum,
+	ErrInvalidResponseHeader,
+	ErrResponseTooShort,
+	ErrSimulatorClosed,
+	ErrSimulatorNoResponse,
+	ErrSimulatorBusy,
+	ErrSimulatorStreamStopped,
+	context.DeadlineExceeded,
+	context.Canceled,
+	io.ErrUnexpectedEOF,
+	io.EOF,
+}
+
+func (p Packet) err() error {
+	if p.Error == "" {
+		return nil
+	}
+
+	// Wrapped errors are recorded as "context: sentinel"
+	for _, sentinel := range replayErrors {
+		if p.Error == sentinel.Error() {
+			return sentinel
+		} else if prefix := strings.TrimSuffix(p.Error, ": "+sentinel.Error()); prefix != p.Error {
+			return fmt.Errorf("%s: %w", prefix, sentinel)
+		}
+	}
+	return errors.New(p.Error)
+}
+
+// Write checks the command against the recording.
+func (r *Replay) Write(ctx context.Context, p []byte) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	// A failed write records the bytes sent before the error
+	packet, err := r.next(PipeCommand)
+	if err != nil {
+		return 0, err
+	} else if packet.Error != "" && bytes.HasPrefix(p, packet.Data) {
+		return len(packet.Data), packet.err()
+	} else if !bytes.Equal(packet.Data, p) {
+		return 0, ErrReplayMismatch{packet.Data, append([]byte(nil), p...)}
+	}
+	return len(packet.Data), packet.err()
+}
+
+// Read returns the next recorded response.
+func (r *Replay) Read(ctx context.Context, p []byte) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	packet, err := r.next(PipeResponse)
+	if err != nil {
+		return 0, err
+	}
+	return copy(p, packet.Data), packet.err()
+}
+
+// OpenStream returns a reader of the recorded stream data.
+func (r *Replay) OpenStream(transferSize int) (StreamReader, error) {
+	return &replayStream{replay: r}, nil
+}
+
+// Close is a no-op.
+func (r *Replay) Close() error {
+	return nil
+}
+
+type replayStream struct {
+	replay  *Replay
+	pending []byte
+}
+
+func (s *replayStream) Read(ctx context.Context, p []byte) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	} else if len(s.pending) == 0 {
+		packet, err := s.replay.next(PipeStream)
+		if err == ErrReplayExhausted {
+			return 0, io.EOF
+		} else if err != nil {
+			return 0, err
+		} else if packet.Error != "" {
+			return 0, packet.err()
+		}
+		s.pending = packet.Data
+	}
+
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+func (s *replayStream) Close() error {
+	return nil
+}
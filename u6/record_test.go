@@ -0,0 +1,118 @@
+package u6_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/eliquious/labjack/u6"
+)
+
+func Test_RecordReplay(t *testing.T) {
+	var recording bytes.Buffer
+
+	sim := u6.NewSimulator()
+	sim.SetAIN(3, 2.5)
+	sim.SetDigital(u6.FIO2, true)
+
+	// Record a session
+	dev, err := u6.Open(u6.NewRecorder(sim, &recording))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ain := &u6.FeedbackAIN24{PositiveChannel: 3, ResolutionIndex: 8}
+	fio := &u6.FeedbackBitStateRead{BitNumber: u6.FIO2}
+	if err = dev.Feedback(fio, ain); err != nil {
+		t.Fatal(err)
+	}
+	recorded, _ := ain.GetVoltage()
+	dev.Close()
+
+	// Replay the session
+	replay, err := u6.NewReplay(&recording)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev, err = u6.Open(replay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dev.Close()
+
+	if dev.DeviceDesc().SerialNumber != sim.SerialNumber {
+		t.Fatalf("Serial number does not match: %d != %d", dev.DeviceDesc().SerialNumber, sim.SerialNumber)
+	}
+
+	ain = &u6.FeedbackAIN24{PositiveChannel: 3, ResolutionIndex: 8}
+	fio = &u6.FeedbackBitStateRead{BitNumber: u6.FIO2}
+	if err = dev.Feedback(fio, ain); err != nil {
+		t.Fatal(err)
+	}
+
+	replayed, _ := ain.GetVoltage()
+	if replayed != recorded || !fio.GetState() {
+		t.Fatalf("Replay does not match: AIN3=%v != %v; FIO2=%v", replayed, recorded, fio.GetState())
+	}
+
+	// The recording is exhausted
+	if err = dev.Feedback(ain); err == nil {
+		t.Fatal("Expected replay to be exhausted")
+	}
+}
+
+func Test_ReplayMismatch(t *testing.T) {
+	var recording bytes.Buffer
+
+	dev, err := u6.Open(u6.NewRecorder(u6.NewSimulator(), &recording))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = dev.Feedback(&u6.FeedbackAIN24{PositiveChannel: 0, ResolutionIndex: 8}); err != nil {
+		t.Fatal(err)
+	}
+	dev.Close()
+
+	replay, err := u6.NewReplay(&recording)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev, err = u6.Open(replay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dev.Close()
+
+	err = dev.Feedback(&u6.FeedbackAIN24{PositiveChannel: 1, ResolutionIndex: 8})
+	if _, ok := err.(u6.ErrReplayMismatch); !ok {
+		t.Fatalf("Expected ErrReplayMismatch; got %v", err)
+	}
+}
+
+func Test_ReplayErrors(t *testing.T) {
+	var recording bytes.Buffer
+
+	sim := u6.NewSimulator()
+	dev, err := u6.Open(u6.NewRecorder(sim, &recording), u6.WithRetryPolicy(u6.RetryPolicy{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.Unplug()
+	if err = dev.Feedback(&u6.FeedbackBitStateRead{BitNumber: u6.FIO0}); !errors.Is(err, u6.ErrDeviceDisconnected) {
+		t.Fatalf("Expected ErrDeviceDisconnected; got %v", err)
+	}
+	dev.Close()
+
+	replay, err := u6.NewReplay(&recording)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev, err = u6.Open(replay, u6.WithRetryPolicy(u6.RetryPolicy{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dev.Close()
+
+	if err = dev.Feedback(&u6.FeedbackBitStateRead{BitNumber: u6.FIO0}); !errors.Is(err, u6.ErrDeviceDisconnected) {
+		t.Fatalf("Expected replayed ErrDeviceDisconnected; got %v", err)
+	}
+}
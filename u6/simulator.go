@@ -0,0 +1,558 @@
+package u6
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrSimulatorClosed is returned when a closed Simulator is used.
+var ErrSimulatorClosed = errors.New("Simulator is closed")
+
+// ErrSimulatorNoResponse is returned when a response is read without a pending command.
+var ErrSimulatorNoResponse = errors.New("Simulator has no pending response")
+
+// ErrSimulatorBusy is returned when a command is written before the previous response was read.
+var ErrSimulatorBusy = errors.New("Simulator response has not been read")
+
+// ErrSimulatorStreamStopped is returned when stream data is read while the stream is not running.
+var ErrSimulatorStreamStopped = errors.New("Simulator stream is not running")
+
+// Simulator is an in-process U6 which speaks the U6 wire protocol. It
+// implements Transport so the whole driver can be exercised without hardware.
+type Simulator struct {
+	SerialNumber int
+	LocalID      int
+	Pro          bool
+	Calibration  CalibrationInfo
+
+	// ResponseDelay delays every command response.
+	ResponseDelay time.Duration
+
+	mu        sync.Mutex
+	closed    bool
+	unplugged bool
+	response  []byte
+	corrupt   int
+	ain       map[int]float64
+	direction uint32
+	state     uint32
+	dac       [2]uint16
+
+	streaming    bool
+	stream       simStreamConfig
+	channelIndex int
+	packetNumber byte
+}
+
+type simStreamConfig struct {
+	ResolutionIndex  byte
+	SamplesPerPacket int
+	Channels         []ChannelConfig
+}
+
+// NewSimulator creates a simulated U6 with the default calibration.
+func NewSimulator() *Simulator {
+	return &Simulator{
+		SerialNumber: 360000001,
+		LocalID:      1,
+		Calibration:  DefaultCalibrationInfo,
+		ain:          make(map[int]float64),
+	}
+}
+
+// SetAIN sets the voltage presented on an analog input channel.
+func (s *Simulator) SetAIN(channel int, volts float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ain[channel] = volts
+}
+
+// SetTemperature sets the internal temperature in Kelvin, presented on AIN14
+// using the temperature calibration.
+func (s *Simulator) SetTemperature(kelvin float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ain[TemperatureChannel] = (kelvin - s.Calibration.CalConstants[23]) / s.Calibration.CalConstants[22]
+}
+
+// SetDigital sets the state of a digital line.
+func (s *Simulator) SetDigital(bit DigitalIOBit, state bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setBit(&s.state, bit, state)
+}
+
+// Digital returns the direction and state of a digital line.
+func (s *Simulator) Digital(bit DigitalIOBit) (BitDirection, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dir := BitDirectionRead
+	if s.direction&(1<<bit) != 0 {
+		dir = BitDirectionWrite
+	}
+	return dir, s.state&(1<<bit) != 0
+}
+
+// DAC returns the output voltage of DAC0 or DAC1 using the DAC calibration.
+func (s *Simulator) DAC(dac int) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return (float64(s.dac[dac]) - s.Calibration.CalConstants[17+2*dac]) / s.Calibration.CalConstants[16+2*dac]
+}
+
+// CorruptResponses corrupts the next n command responses.
+func (s *Simulator) CorruptResponses(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.corrupt = n
+}
+
+// Unplug simulates removing the device. Commands and stream reads fail with
+// ErrDeviceDisconnected, and the digital lines and the stream are reset as
+// after a power cycle.
+func (s *Simulator) Unplug() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unplugged = true
+	s.response = nil
+	s.direction = 0
+	s.state = 0
+	s.dac = [2]uint16{}
+	s.streaming = false
+	s.stream = simStreamConfig{}
+}
+
+// Plug reattaches an unplugged simulator. It can be used again even if it was closed.
+func (s *Simulator) Plug() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unplugged = false
+	s.closed = false
+}
+
+func (s *Simulator) setBit(mask *uint32, bit DigitalIOBit, on bool) {
+	if on {
+		*mask |= 1 << bit
+	} else {
+		*mask &^= 1 << bit
+	}
+}
+
+// Write handles a command packet sent on the command pipe.
+func (s *Simulator) Write(ctx context.Context, p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	} else if s.unplugged {
+		return 0, ErrDeviceDisconnected
+	} else if s.closed {
+		return 0, ErrSimulatorClosed
+	} else if s.response != nil {
+		return 0, ErrSimulatorBusy
+	}
+
+	// The U6 reads a single 64 byte USB packet
+	if len(p) > 64 {
+		s.response = s.handle(p[:64])
+	} else {
+		s.response = s.handle(p)
+	}
+	if s.corrupt > 0 {
+		s.corrupt--
+		s.response[len(s.response)-1] ^= 0x01
+	}
+	return len(p), nil
+}
+
+// Read returns the response to the last command.
+func (s *Simulator) Read(ctx context.Context, p []byte) (int, error) {
+	if s.ResponseDelay > 0 {
+		timer := time.NewTimer(s.ResponseDelay)
+		defer timer.Stop()
+
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-timer.C:
+		}
+	} else if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.unplugged {
+		return 0, ErrDeviceDisconnected
+	} else if s.closed {
+		return 0, ErrSimulatorClosed
+	} else if s.response == nil {
+		return 0, ErrSimulatorNoResponse
+	}
+	resp := s.response
+	s.response = nil
+	return copy(p, resp), nil
+}
+
+// OpenStream returns a reader of simulated stream packets.
+func (s *Simulator) OpenStream(transferSize int) (StreamReader, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.unplugged {
+		return nil, ErrDeviceDisconnected
+	} else if s.closed {
+		return nil, ErrSimulatorClosed
+	}
+	return &simStream{s}, nil
+}
+
+// Close closes the simulator.
+func (s *Simulator) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.streaming = false
+	return nil
+}
+
+func (s *Simulator) handle(p []byte) []byte {
+	if len(p) < 2 {
+		return []byte{0xB8, 0xB8}
+	}
+
+	// Normal commands
+	if p[1]&0x78 != 0x78 {
+		if normalChecksum8(p[1:]) != p[0] {
+			return []byte{0xB8, 0xB8}
+		}
+		switch p[1] {
+		case 0xA8:
+			return s.streamStart()
+		case 0xB0:
+			return s.streamStop()
+		}
+		return []byte{0xB8, 0xB8}
+	}
+
+	// Extended commands
+	if len(p) < 8 {
+		return []byte{0xB8, 0xB8}
+	}
+	c16, _ := extendedChecksum16(p)
+	c8, _ := extendedChecksum8(p)
+	if c8 != p[0] || byte(c16&0xFF) != p[4] || byte(c16>>8) != p[5] {
+		return []byte{0xB8, 0xB8}
+	}
+
+	switch p[3] {
+	case 0x08:
+		return s.configU6()
+	case 0x2D:
+		return s.readCal(p)
+	case 0x00:
+		return s.feedback(p)
+	case 0x11:
+		return s.streamConfig(p)
+	}
+	return []byte{0xB8, 0xB8}
+}
+
+func (s *Simulator) configU6() []byte {
+	resp := make([]byte, 38)
+	resp[1] = 0xF8
+	resp[2] = 0x10
+	resp[3] = 0x08
+	resp[9] = 43  // Firmware minor
+	resp[10] = 1  // Firmware major
+	resp[11] = 27 // Bootloader minor
+	resp[12] = 0  // Bootloader major
+	resp[13] = 0  // Hardware minor
+	resp[14] = 2  // Hardware major
+	binary.LittleEndian.PutUint32(resp[15:], uint32(s.SerialNumber))
+	binary.LittleEndian.PutUint16(resp[19:], 6)
+	resp[21] = byte(s.LocalID)
+	resp[37] = 4
+	if s.Pro {
+		resp[37] = 12
+	}
+	setChecksum(resp)
+	return resp
+}
+
+func (s *Simulator) readCal(p []byte) []byte {
+	resp := make([]byte, 40)
+	resp[1] = 0xF8
+	resp[2] = 0x11
+	resp[3] = 0x2D
+
+	block := int(p[7])
+	if block > 9 {
+		resp[6] = byte(ErrInvalidBlock)
+	} else {
+		for i := 0; i < 4; i++ {
+			float64ToUint8Array(s.Calibration.CalConstants[block*4+i], resp[8:], i*8)
+		}
+	}
+	setChecksum(resp)
+	return resp
+}
+
+func (s *Simulator) feedback(p []byte) []byte {
+	var data []byte
+	var errCode, errFrame byte
+
+	var frame int
+	cmds := p[7:]
+	for len(cmds) > 0 {
+
+		// Trailing padding byte
+		if cmds[0] == 0 {
+			cmds = cmds[1:]
+			continue
+		}
+
+		size, out, code := s.ioType(cmds)
+		if code != 0 {
+			errCode, errFrame = code, byte(frame)
+			break
+		}
+		data = append(data, out...)
+		cmds = cmds[size:]
+		frame++
+	}
+
+	resp := make([]byte, 9+len(data))
+	resp[1] = 0xF8
+	resp[2] = byte((len(resp) - 5) / 2)
+	resp[3] = 0x00
+	resp[6] = errCode
+	resp[7] = errFrame
+	resp[8] = p[6]
+	copy(resp[9:], data)
+	setChecksum(resp)
+	return resp
+}
+
+// simIOTypeSizes maps the supported IOTypes to their command size.
+var simIOTypeSizes = map[byte]int{
+	2:  4, // AIN24
+	3:  4, // AIN24AR
+	10: 2, // BitStateRead
+	11: 2, // BitStateWrite
+	12: 2, // BitDirRead
+	13: 2, // BitDirWrite
+	26: 1, // PortStateRead
+	27: 7, // PortStateWrite
+	28: 1, // PortDirRead
+	29: 7, // PortDirWrite
+	38: 3, // DAC0 (16-bit)
+	39: 3, // DAC1 (16-bit)
+}
+
+// ioType executes the IOType at the start of cmd and returns the command
+// size, the response data and the error code.
+func (s *Simulator) ioType(cmd []byte) (int, []byte, byte) {
+	size, ok := simIOTypeSizes[cmd[0]]
+	if !ok || len(cmd) < size {
+		return 0, nil, byte(ErrIOTypeNotValid)
+	}
+
+	switch cmd[0] {
+	case 2: // AIN24
+		raw := s.rawAIN(int(cmd[1]), int(cmd[2]>>4), int(cmd[2]&0x0F)) * 256
+		return size, []byte{byte(raw), byte(raw >> 8), byte(raw >> 16)}, 0
+	case 3: // AIN24AR
+		gainIndex := int(cmd[2] >> 4)
+		if gainIndex == AutoRangeGainIndex {
+			gainIndex = s.autoRange(int(cmd[1]))
+		}
+		raw := s.rawAIN(int(cmd[1]), gainIndex, int(cmd[2]&0x0F)) * 256
+		return size, []byte{byte(raw), byte(raw >> 8), byte(raw >> 16), cmd[2]&0x0F | byte(gainIndex)<<4, 0}, 0
+	case 10: // BitStateRead
+		return size, []byte{byte(s.state>>(cmd[1]&0x1F)) & 1}, 0
+	case 11: // BitStateWrite
+		s.setBit(&s.state, DigitalIOBit(cmd[1]&0x1F), cmd[1]&0x80 != 0)
+	case 12: // BitDirRead
+		return size, []byte{byte(s.direction>>(cmd[1]&0x1F)) & 1}, 0
+	case 13: // BitDirWrite
+		s.setBit(&s.direction, DigitalIOBit(cmd[1]&0x1F), cmd[1]&0x80 != 0)
+	case 26: // PortStateRead
+		return size, []byte{byte(s.state), byte(s.state >> 8), byte(s.state >> 16)}, 0
+	case 27: // PortStateWrite
+		mask := uint32(cmd[1]) | uint32(cmd[2])<<8 | uint32(cmd[3]&0x0F)<<16
+		state := uint32(cmd[4]) | uint32(cmd[5])<<8 | uint32(cmd[6]&0x0F)<<16
+		s.state = s.state&^mask | state&mask
+	case 28: // PortDirRead
+		return size, []byte{byte(s.direction), byte(s.direction >> 8), byte(s.direction >> 16)}, 0
+	case 29: // PortDirWrite
+		mask := uint32(cmd[1]) | uint32(cmd[2])<<8 | uint32(cmd[3]&0x0F)<<16
+		dir := uint32(cmd[4]) | uint32(cmd[5])<<8 | uint32(cmd[6]&0x0F)<<16
+		s.direction = s.direction&^mask | dir&mask
+	case 38, 39: // DAC0 (16-bit), DAC1 (16-bit)
+		s.dac[cmd[0]-38] = binary.LittleEndian.Uint16(cmd[1:])
+	}
+	return size, nil, 0
+}
+
+// autoRange selects the highest gain whose range holds the simulated voltage.
+func (s *Simulator) autoRange(channel int) int {
+	volts := math.Abs(s.ain[channel])
+	gainIndex := 0
+	for limit := 1.0; gainIndex < 3 && volts < limit*0.95; limit /= 10 {
+		gainIndex++
+	}
+	return gainIndex
+}
+
+// rawAIN converts the simulated voltage into 16-bit counts using the
+// calibration of the gain and resolution.
+func (s *Simulator) rawAIN(channel, gainIndex, resolutionIndex int) uint32 {
+	if gainIndex > 3 {
+		gainIndex = 0
+	}
+
+	var indexAdjust int
+	if resolutionIndex > 8 {
+		indexAdjust = 24
+	}
+	volts := s.ain[channel]
+	slope := s.Calibration.CalConstants[indexAdjust+gainIndex*2]
+	negSlope := s.Calibration.CalConstants[indexAdjust+gainIndex*2+8]
+	center := s.Calibration.CalConstants[indexAdjust+gainIndex*2+9]
+
+	value := center + volts/slope
+	if volts < 0 {
+		value = center - volts/negSlope
+	}
+	if value < 0 {
+		value = 0
+	} else if value > 65535 {
+		value = 65535
+	}
+	return uint32(value)
+}
+
+func (s *Simulator) streamConfig(p []byte) []byte {
+	resp := make([]byte, 8)
+	resp[1] = 0xF8
+	resp[2] = 0x01
+	resp[3] = 0x11
+
+	numChannels := int(p[6])
+	if s.streaming {
+		resp[6] = byte(ErrStreamIsActive)
+	} else if len(p) < 14+2*numChannels || numChannels == 0 || p[8] < 1 || p[8] > 25 {
+		resp[6] = byte(ErrStreamConfigInvalid)
+	} else {
+		config := simStreamConfig{ResolutionIndex: p[7], SamplesPerPacket: int(p[8])}
+		for i := 0; i < numChannels; i++ {
+			config.Channels = append(config.Channels, ChannelConfig{
+				PositiveChannel: p[14+i*2],
+				GainIndex:       GainIndex((p[15+i*2] >> 4) & 0x0F),
+				Differential:    DifferentialInput(p[15+i*2] & 0x80),
+			})
+		}
+		s.stream = config
+	}
+	setChecksum(resp)
+	return resp
+}
+
+func (s *Simulator) streamStart() []byte {
+	resp := []byte{0, 0xA9, 0, 0}
+	if s.stream.SamplesPerPacket == 0 {
+		resp[2] = byte(ErrStreamConfigInvalid)
+	} else if s.streaming {
+		resp[2] = byte(ErrStreamIsActive)
+	} else {
+		s.streaming = true
+		s.channelIndex = 0
+		s.packetNumber = 0
+	}
+	resp[0] = normalChecksum8(resp[1:])
+	return resp
+}
+
+func (s *Simulator) streamStop() []byte {
+	resp := []byte{0, 0xB1, 0, 0}
+	if !s.streaming {
+		resp[2] = byte(ErrStreamNotRunning)
+	}
+	s.streaming = false
+	resp[0] = normalChecksum8(resp[1:])
+	return resp
+}
+
+// streamPacket builds the next stream data packet.
+func (s *Simulator) streamPacket() []byte {
+	spp := s.stream.SamplesPerPacket
+	packet := make([]byte, 14+2*spp)
+	packet[1] = 0xF9
+	packet[2] = byte(4 + spp)
+	packet[3] = 0xC0
+	packet[10] = s.packetNumber
+	for i := 0; i < spp; i++ {
+		ch := s.stream.Channels[s.channelIndex]
+
+		var raw uint32
+		switch ch.PositiveChannel {
+		case 193: // FIO and EIO
+			raw = s.state & 0xFFFF
+		case 194: // CIO
+			raw = (s.state >> 16) & 0x0F
+		default:
+			raw = s.rawAIN(int(ch.PositiveChannel), int(ch.GainIndex), int(s.stream.ResolutionIndex))
+		}
+		binary.LittleEndian.PutUint16(packet[12+i*2:], uint16(raw))
+
+		s.channelIndex = (s.channelIndex + 1) % len(s.stream.Channels)
+	}
+	s.packetNumber++
+	setChecksum(packet)
+	return packet
+}
+
+// simStream reads whole stream packets from the simulator. Reads into a
+// buffer shorter than one packet fail with io.ErrShortBuffer.
+type simStream struct {
+	sim *Simulator
+}
+
+func (r *simStream) Read(ctx context.Context, p []byte) (int, error) {
+	r.sim.mu.Lock()
+	defer r.sim.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	} else if r.sim.unplugged {
+		return 0, ErrDeviceDisconnected
+	} else if r.sim.closed {
+		return 0, ErrSimulatorClosed
+	} else if !r.sim.streaming {
+		return 0, ErrSimulatorStreamStopped
+	}
+
+	size := 14 + 2*r.sim.stream.SamplesPerPacket
+	if len(p) < size {
+		return 0, io.ErrShortBuffer
+	}
+
+	var n int
+	for n+size <= len(p) {
+		n += copy(p[n:], r.sim.streamPacket())
+	}
+	return n, nil
+}
+
+func (r *simStream) Close() error {
+	return nil
+}
@@ -0,0 +1,214 @@
+package u6
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds of the latency histogram buckets.
+var LatencyBuckets = []time.Duration{
+	250 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	2 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	time.Second,
+}
+
+// Histogram counts durations by LatencyBuckets.
+type Histogram struct {
+
+	// Counts holds the number of durations up to the matching bucket of
+	// LatencyBuckets. The last count holds the longer durations.
+	Counts []uint64
+	Count  uint64
+	Sum    time.Duration
+	Max    time.Duration
+}
+
+func (h *Histogram) observe(d time.Duration) {
+	if h.Counts == nil {
+		h.Counts = make([]uint64, len(LatencyBuckets)+1)
+	}
+
+	i := 0
+	for i < len(LatencyBuckets) && d > LatencyBuckets[i] {
+		i++
+	}
+	h.Counts[i]++
+	h.Count++
+	h.Sum += d
+	if d > h.Max {
+		h.Max = d
+	}
+}
+
+func (h Histogram) clone() Histogram {
+	h.Counts = append([]uint64(nil), h.Counts...)
+	return h
+}
+
+// Mean returns the mean duration.
+func (h Histogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// CommandStats holds the metrics of a command.
+type CommandStats struct {
+
+	// Count is the number of commands executed and Errors the number which
+	// failed after all retries.
+	Count  uint64
+	Errors uint64
+
+	// Latency is the duration of the commands, including retries.
+	Latency Histogram
+}
+
+// Stats is a snapshot of the metrics of a U6.
+type Stats struct {
+
+	// Transactions is the number of command/response transactions, including
+	// retries.
+	Transactions  uint64
+	BytesSent     uint64
+	BytesReceived uint64
+	Retries       uint64
+
+	// ChecksumErrors counts the responses with a bad checksum and the bad
+	// checksum echoes (0xB8) of the U6. HeaderErrors counts the responses with
+	// an invalid header.
+	ChecksumErrors uint64
+	HeaderErrors   uint64
+
+	// Commands holds the metrics by command name, see CommandName.
+	Commands map[string]CommandStats
+}
+
+// metrics collects the Stats of a U6.
+type metrics struct {
+	mu    sync.Mutex
+	stats Stats
+}
+
+// transaction counts the bytes transferred by a transaction.
+func (m *metrics) transaction(sent, received int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stats.Transactions++
+	m.stats.BytesSent += uint64(sent)
+	m.stats.BytesReceived += uint64(received)
+}
+
+// failed counts the error of a transaction and whether it is retried.
+func (m *metrics) failed(err error, retry bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if errors.Is(err, ErrInvalidChecksum) || errors.Is(err, ErrInvalidChecksumResponse) {
+		m.stats.ChecksumErrors++
+	} else if errors.Is(err, ErrInvalidResponseHeader) {
+		m.stats.HeaderErrors++
+	}
+	if retry {
+		m.stats.Retries++
+	}
+}
+
+// command records the latency and outcome of a command.
+func (m *metrics) command(name string, latency time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stats.Commands == nil {
+		m.stats.Commands = make(map[string]CommandStats)
+	}
+
+	c := m.stats.Commands[name]
+	c.Count++
+	if err != nil {
+		c.Errors++
+	}
+	c.Latency.observe(latency)
+	m.stats.Commands[name] = c
+}
+
+func (m *metrics) snapshot() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := m.stats
+	stats.Commands = make(map[string]CommandStats, len(m.stats.Commands))
+	for name, c := range m.stats.Commands {
+		c.Latency = c.Latency.clone()
+		stats.Commands[name] = c
+	}
+	return stats
+}
+
+// Stats returns a snapshot of the metrics of the U6.
+func (u *U6) Stats() Stats {
+	return u.metrics.snapshot()
+}
+
+// StreamStats is a snapshot of the metrics of a Stream.
+type StreamStats struct {
+	Packets uint64
+	Bytes   uint64
+	Samples uint64
+
+	// PacketErrors counts the packets with a bad checksum or header and
+	// ReadErrors the failed or incomplete reads.
+	PacketErrors uint64
+	ReadErrors   uint64
+
+	// Recoveries counts the auto-recoveries after the U6 buffer overflowed
+	// and DroppedScans the scans lost during them.
+	Recoveries   uint64
+	DroppedScans uint64
+}
+
+// streamMetrics collects the StreamStats of a Stream.
+type streamMetrics struct {
+	mu    sync.Mutex
+	stats StreamStats
+}
+
+func (m *streamMetrics) read(n int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stats.Bytes += uint64(n)
+	if err != nil {
+		m.stats.ReadErrors++
+	}
+}
+
+func (m *streamMetrics) packet(packet streamPacket, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		m.stats.PacketErrors++
+		return
+	}
+
+	m.stats.Packets++
+	m.stats.Samples += uint64(len(packet.Samples))
+	if packet.ErrorCode == ErrStreamAutoRecoverReport {
+		m.stats.Recoveries++
+		m.stats.DroppedScans += uint64(packet.Dropped)
+	}
+}
+
+// Stats returns a snapshot of the metrics of the stream.
+func (s *Stream) Stats() StreamStats {
+	s.metrics.mu.Lock()
+	defer s.metrics.mu.Unlock()
+	return s.metrics.stats
+}
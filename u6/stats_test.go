@@ -0,0 +1,81 @@
+package u6_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/eliquious/labjack/u6"
+)
+
+func Test_Stats(t *testing.T) {
+	sim, dev := openSimulator(t)
+	defer dev.Close()
+
+	before := dev.Stats()
+	if before.Commands["ReadCal"].Count != 10 {
+		t.Fatalf("Invalid ReadCal count: %+v", before.Commands["ReadCal"])
+	}
+
+	sim.CorruptResponses(1)
+	for i := 0; i < 3; i++ {
+		if err := dev.Feedback(&u6.FeedbackBitStateRead{BitNumber: u6.FIO0}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := dev.Stats()
+	feedback := stats.Commands["Feedback"]
+	if feedback.Count != 3 || feedback.Errors != 0 || feedback.Latency.Count != 3 {
+		t.Fatalf("Invalid Feedback stats: %+v", feedback)
+	} else if stats.Transactions-before.Transactions != 4 || stats.Retries != 1 || stats.ChecksumErrors != 1 {
+		t.Fatalf("Invalid stats: %+v", stats)
+	} else if stats.BytesSent-before.BytesSent != 40 || stats.BytesReceived-before.BytesReceived != 40 {
+		t.Fatalf("Invalid byte counts: sent=%d; received=%d", stats.BytesSent-before.BytesSent, stats.BytesReceived-before.BytesReceived)
+	}
+
+	var buckets uint64
+	for _, c := range feedback.Latency.Counts {
+		buckets += c
+	}
+	if buckets != 3 || feedback.Latency.Mean() <= 0 || feedback.Latency.Max < feedback.Latency.Mean() {
+		t.Fatalf("Invalid latency histogram: %+v", feedback.Latency)
+	}
+}
+
+func Test_StreamStats(t *testing.T) {
+	_, dev := openSimulator(t)
+	defer dev.Close()
+
+	stream, err := dev.NewStream(&u6.StreamConfig{
+		ResolutionIndex:  1,
+		SamplesPerPacket: 4,
+		ScanConfig:       &u6.ScanConfig{ClockSpeed: u6.ClockSpeed4Mhz, ScanInterval: 4000},
+		Channels:         []u6.ChannelConfig{{PositiveChannel: 0}, {PositiveChannel: 1}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch, err := stream.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		select {
+		case resp := <-ch:
+			if resp.Error != nil {
+				t.Fatal(resp.Error)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("No stream data")
+		}
+	}
+	stream.Stop()
+
+	stats := stream.Stats()
+	if stats.Packets < 10 || stats.Samples != stats.Packets*4 || stats.Bytes < stats.Packets*22 || stats.Bytes%220 != 0 {
+		t.Fatalf("Invalid stream stats: %+v", stats)
+	} else if stats.PacketErrors != 0 || stats.ReadErrors != 0 {
+		t.Fatalf("Unexpected stream errors: %+v", stats)
+	}
+}
@@ -2,12 +2,12 @@ package u6
 
 import (
 	// "bufio"
+	"context"
 	"errors"
 	"fmt"
-	"github.com/eliquious/labjack"
-	"github.com/google/gousb"
-	"io"
 	"time"
+
+	"github.com/eliquious/labjack/frame"
 )
 
 type StreamConfig struct {
@@ -19,6 +19,51 @@ type StreamConfig struct {
 	Channels         []ChannelConfig
 }
 
+// bytes encodes the StreamConfig command data.
+func (c *StreamConfig) bytes() []byte {
+	data := make([]byte, 8+2*len(c.Channels))
+	data[0] = byte(len(c.Channels))
+	data[1] = byte(c.ResolutionIndex)
+	data[2] = byte(c.SamplesPerPacket)
+	data[4] = byte(c.SettlingFactor)
+	data[5] = c.ScanConfig.GetByte()
+	data[6] = byte(c.ScanConfig.ScanInterval & 0x00FF)
+	data[7] = byte(c.ScanConfig.ScanInterval / 256)
+
+	for i, ch := range c.Channels {
+		data[8+i*2] = ch.PositiveChannel
+		data[9+i*2] = byte(ch.Differential) + byte(ch.GainIndex)<<4
+	}
+	return data
+}
+
+// parseStreamConfig decodes the StreamConfig command data.
+func parseStreamConfig(data []byte) (*StreamConfig, error) {
+	if len(data) < 8 || len(data) < 8+2*int(data[0]) {
+		return nil, ErrResponseTooShort
+	}
+
+	config := &StreamConfig{
+		ResolutionIndex:  data[1],
+		SamplesPerPacket: data[2],
+		SettlingFactor:   data[4],
+		ScanConfig: &ScanConfig{
+			ClockSpeed:   ClockSpeed(data[5] & 0x08),
+			DivideBy256:  ClockDivision(data[5] & 0x02),
+			ScanInterval: uint16(data[6]) + uint16(data[7])*256,
+		},
+		Channels: make([]ChannelConfig, data[0]),
+	}
+	for i := range config.Channels {
+		config.Channels[i] = ChannelConfig{
+			PositiveChannel: data[8+i*2],
+			GainIndex:       GainIndex(data[9+i*2] >> 4 & 0x07),
+			Differential:    DifferentialInput(data[9+i*2] & 0x80),
+		}
+	}
+	return config, nil
+}
+
 type ChannelConfig struct {
 	PositiveChannel byte
 	GainIndex       GainIndex
@@ -96,149 +141,216 @@ func (c *ChannelData) EIO(pin int) int {
 }
 
 type Stream struct {
-	device   *U6
-	config   *StreamConfig
-	stopCh   chan struct{}
-	closeInf func()
+	device  *U6
+	config  *StreamConfig
+	header  []byte
+	cancel  context.CancelFunc
+	metrics streamMetrics
 }
 
 func (s *Stream) Start() (chan StreamResponse, error) {
+	return s.StartContext(context.Background())
+}
+
+// StartContext starts the stream. The context bounds the start up; once
+// started the stream runs until Stop is called. If the context is done after
+// the device started streaming, the stream is stopped again.
+func (s *Stream) StartContext(ctx context.Context) (chan StreamResponse, error) {
 	// var dataCh chan StreamResponse
 	dataCh := make(chan StreamResponse, 100)
 
 	// Stop existing streams
-	err := s.stop()
+	err := s.stop(ctx)
 	if err != nil {
 		return dataCh, err
 	}
 	// fmt.Println("Stopped any existing streams")
 
 	// Start new stream
-	err = s.start()
+	err = s.start(ctx)
 	if err != nil {
+		if ctx.Err() != nil {
+			s.stop(context.Background())
+		}
 		return dataCh, err
 	}
 	// fmt.Println("Started new stream")
 
-	// Open USB interface
-	inf, done, err := s.device.device.DefaultInterface()
+	// Open stream endpoint
+	stream, gen, err := s.device.openStream(s.transferSize())
+	if err == nil {
+		err = ctx.Err()
+	}
 	if err != nil {
+		if stream != nil {
+			stream.Close()
+		}
+		s.stop(context.Background())
 		return dataCh, err
 	}
-	// defer done()
 
-	// Open endpoint
-	in, err := inf.InEndpoint(labjack.U6PipeInEP3)
-	if err != nil {
-		done()
-		return dataCh, err
+	streamCtx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.device.addStream(s)
+	go s.readStream(streamCtx, dataCh, stream, gen)
+	return dataCh, nil
+}
+
+func (s *Stream) transferSize() int {
+	return int(14*s.config.SamplesPerPacket*2) * 10
+}
+
+// resume configures and starts the stream again after a reconnect.
+func (s *Stream) resume(ctx context.Context) error {
+	if err := s.device.configureStream(ctx, s.header); err != nil {
+		return err
 	}
-	// in.Timeout = time.Second
+	return s.start(ctx)
+}
 
-	stream, err := in.NewStream(int(14*s.config.SamplesPerPacket*2)*10, 20)
-	if err != nil {
-		done()
-		return dataCh, err
+// openStream opens the stream pipe and returns the connection generation it
+// belongs to.
+func (u *U6) openStream(transferSize int) (StreamReader, int, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.lost {
+		return nil, u.generation, ErrDeviceDisconnected
+	}
+	stream, err := u.transport.OpenStream(transferSize)
+	return stream, u.generation, err
+}
+
+func (u *U6) addStream(s *Stream) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.streams[s] = struct{}{}
+}
+
+func (u *U6) removeStream(s *Stream) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.streams, s)
+}
+
+// send delivers a response unless the stream is stopped.
+func (s *Stream) send(ctx context.Context, dataCh chan StreamResponse, resp StreamResponse) {
+	select {
+	case dataCh <- resp:
+	case <-ctx.Done():
+	}
+}
+
+// reopenStream opens the stream pipe after a reconnect. Failures are reported
+// and retried after the reconnect interval, reconnecting again if needed, until
+// the stream is stopped or reconnecting is disabled.
+func (s *Stream) reopenStream(ctx context.Context, dataCh chan StreamResponse, gen int) (StreamReader, int, bool) {
+	for {
+		next, g, err := s.device.openStream(s.transferSize())
+		if err == nil {
+			return next, g, true
+		}
+		s.send(ctx, dataCh, StreamResponse{Timestamp: time.Now(), Error: err})
+
+		timer := time.NewTimer(s.device.reconnectInterval())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, gen, false
+		case <-timer.C:
+		}
+		if !s.device.reconnectEnabled() || errors.Is(err, ErrDeviceDisconnected) && !s.device.recover(ctx, g) {
+			return nil, gen, false
+		}
 	}
-	s.closeInf = done
-	go s.readStream(dataCh, stream)
-	return dataCh, nil
 }
 
-func (s *Stream) readStream(dataCh chan StreamResponse, stream *gousb.ReadStream) {
-	defer stream.Close()
+func (s *Stream) readStream(ctx context.Context, dataCh chan StreamResponse, stream StreamReader, gen int) {
+	defer func() { stream.Close() }()
 
 	var n int
 	var err error
 	var scanNumber int
 	var channelIndex int
 	var packetNumber int
-	var checksumTotal8 uint8
-	var checksumTotal16 uint16
 	samplesPerPacket := s.config.SamplesPerPacket
-	bytelimit := int(12 + s.config.SamplesPerPacket*2)
 	numChannels := len(s.config.Channels)
 	packetsPerRequest := 10
 
 	var recvBuffer []byte
 	packestSize := int(14 + s.config.SamplesPerPacket*2)
 	reqBuffer := make([]byte, packestSize*packetsPerRequest)
+
+	// The calibration and trace hook are taken once, and again after a
+	// reconnect, rather than for every packet.
+	calInfo, trace := s.device.GetCalibrationInfo(), s.device.tracer()
 	for {
 		select {
-		case <-s.stopCh:
-			s.closeInf()
-			s.stop()
+		case <-ctx.Done():
+			s.stop(withoutReconnect(context.Background()))
 			return
 		default:
-			n, err = io.ReadFull(stream, reqBuffer)
-			if err != nil {
-				dataCh <- StreamResponse{Timestamp: time.Now(), Error: err}
+			start := time.Now()
+			n, err = readFull(ctx, stream, reqBuffer)
+			tracePacket(trace, DirectionIn, reqBuffer[:n], start, err)
+			if ctx.Err() != nil {
+				continue
+			} else if errors.Is(err, ErrDeviceDisconnected) && s.device.recover(ctx, gen) {
+
+				// The stream was restarted by the reconnect
+				if next, g, ok := s.reopenStream(ctx, dataCh, gen); ok {
+					stream.Close()
+					stream, gen = next, g
+					calInfo, trace = s.device.GetCalibrationInfo(), s.device.tracer()
+				} else if ctx.Err() == nil {
+
+					// The stream pipe cannot be reopened; end the stream
+					s.device.removeStream(s)
+					s.send(ctx, dataCh, StreamResponse{Timestamp: time.Now(), Error: ErrDeviceDisconnected})
+					return
+				}
+				continue
+			} else if err != nil {
+				s.metrics.read(n, err)
+				s.send(ctx, dataCh, StreamResponse{Timestamp: time.Now(), Error: err})
 				continue
 			} else if n != len(reqBuffer) {
-				fmt.Printf("Failed to read complete response: %d != %d\n", n, len(reqBuffer))
-				dataCh <- StreamResponse{Timestamp: time.Now(), Error: ErrResponseTooShort}
+				s.metrics.read(n, ErrResponseTooShort)
+				s.device.log().Warn("Incomplete stream read", "read", n, "expected", len(reqBuffer))
+				s.send(ctx, dataCh, StreamResponse{Timestamp: time.Now(), Error: ErrResponseTooShort})
 				continue
 			}
+			s.metrics.read(n, nil)
 
 			for i := 0; i < packetsPerRequest; i++ {
 				offset := packestSize * i
 				recvBuffer = reqBuffer[offset : offset+packestSize]
 
-				checksumTotal16, err = extendedChecksum16(recvBuffer)
+				packet, err := parseStreamPacket(recvBuffer, int(samplesPerPacket))
+				s.metrics.packet(packet, err)
 				if err != nil {
-					dataCh <- StreamResponse{Timestamp: time.Now(), Error: err}
-					continue
-				} else if byte((checksumTotal16>>8)&0xff) != recvBuffer[5] {
-					dataCh <- StreamResponse{Timestamp: time.Now(), Error: ErrInvalidChecksumResponse}
-					continue
-				} else if byte(checksumTotal16&0xff) != recvBuffer[4] {
-					dataCh <- StreamResponse{Timestamp: time.Now(), Error: ErrInvalidChecksumResponse}
+					s.send(ctx, dataCh, StreamResponse{Timestamp: time.Now(), Error: err})
 					continue
 				}
 
-				checksumTotal8, err = extendedChecksum8(recvBuffer)
-				if err != nil {
-					dataCh <- StreamResponse{Error: err}
-					continue
-				} else if checksumTotal8 != recvBuffer[0] {
-					dataCh <- StreamResponse{Timestamp: time.Now(), Error: ErrInvalidChecksumResponse}
-					continue
-				}
-
-				if recvBuffer[1] != byte(0xF9) {
-					dataCh <- StreamResponse{Timestamp: time.Now(), Error: ErrInvalidResponseHeader}
-					continue
-				} else if recvBuffer[2] != byte(4+s.config.SamplesPerPacket) {
-					dataCh <- StreamResponse{Timestamp: time.Now(), Error: ErrInvalidResponseHeader}
-					continue
-				} else if recvBuffer[3] != byte(0xC0) {
-					dataCh <- StreamResponse{Timestamp: time.Now(), Error: ErrInvalidResponseHeader}
-					continue
-				}
-
-				if recvBuffer[11] == byte(59) {
+				if code := packet.ErrorCode; code == ErrStreamAutoRecoverActive {
 					// Data overflow
-				} else if recvBuffer[11] == byte(60) {
-					// Auto-recovery packet
-					// recvBuffer[6] + recvBuffer[7]*256 scans dropped
-				} else if recvBuffer[11] != 0 {
-					dataCh <- StreamResponse{Timestamp: time.Now(), Error: ErrLabJackErrorCode{int(recvBuffer[11])}}
+				} else if code == ErrStreamAutoRecoverReport {
+					// Auto-recovery packet, packet.Dropped scans were dropped
+				} else if code != 0 {
+					s.send(ctx, dataCh, StreamResponse{Timestamp: time.Now(), Error: code})
 					continue
 				}
 
-				// Packet ID
-				// packetID = recvBuffer[10]
-
-				// Backlog
 				// Channel data
 				data := make([]*ChannelData, samplesPerPacket)
-				for i := 12; i < bytelimit; i += 2 {
-					data[(i-12)/2] = &ChannelData{
+				for i, raw := range packet.Samples {
+					data[i] = &ChannelData{
 						ChannelIndex:  channelIndex,
 						ScanNumber:    scanNumber,
 						PacketNumber:  packetNumber,
-						Raw:           uint16(recvBuffer[i]) + uint16(recvBuffer[i+1])*256,
-						calInfo:       s.device.calibration,
+						Raw:           raw,
+						calInfo:       calInfo,
 						config:        s.config,
 						channelConfig: s.config.Channels[channelIndex],
 					}
@@ -253,128 +365,80 @@ func (s *Stream) readStream(dataCh chan StreamResponse, stream *gousb.ReadStream
 					packetNumber = 0
 				}
 				packetNumber++
-				dataCh <- StreamResponse{Timestamp: time.Now(), Data: data, PacketNumber: packetNumber}
+				s.send(ctx, dataCh, StreamResponse{Timestamp: time.Now(), Data: data, PacketNumber: packetNumber})
 			}
 		}
 	}
 }
 
-func (s *Stream) start() error {
-
-	header := make([]byte, 2)
-	header[0] = 0xA8
-	header[1] = 0xA8
-	// fmt.Println("After header: ", sendBuffer.Bytes())
-
-	// Open USB interface
-	inf, done, err := s.device.device.DefaultInterface()
-	if err != nil {
-		return err
-	}
-	defer done()
+// streamPacket is a decoded stream data packet.
+type streamPacket struct {
+	PacketNumber byte
+	ErrorCode    ErrorCode
 
-	// Open endpoint
-	out, err := inf.OutEndpoint(labjack.U6PipeOutEP1)
-	if err != nil {
-		return err
-	}
+	// Dropped is the number of scans dropped, reported by the packet ending
+	// an auto-recovery.
+	Dropped int
 
-	// Transmit send buffer
-	n, err := out.Write(header)
-	if err != nil {
-		return err
-	} else if n != len(header) {
-		return errors.New("Send buffer was not written completely")
-	}
+	// Backlog is the number of packets waiting in the U6 buffer.
+	Backlog byte
+	Samples []uint16
+}
 
-	// Open endpoint
-	in, err := inf.InEndpoint(labjack.U6PipeInEP2)
-	if err != nil {
-		return err
+// parseStreamPacket decodes a stream data packet holding samplesPerPacket
+// samples.
+func parseStreamPacket(p []byte, samplesPerPacket int) (streamPacket, error) {
+	if samplesPerPacket < 1 || samplesPerPacket > 25 {
+		return streamPacket{}, fmt.Errorf("Invalid samples per packet %d", samplesPerPacket)
+	} else if len(p) != 14+2*samplesPerPacket {
+		return streamPacket{}, ErrResponseTooShort
+	} else if _, err := frame.ParseStream(p); err != nil {
+		return streamPacket{}, err
 	}
 
-	// Read response
-	recvBuffer := make([]byte, 4)
-	n, err = in.Read(recvBuffer)
-	if err != nil {
-		return err
-	} else if n != len(recvBuffer) {
-		return fmt.Errorf("Full response was not recieved from device: %d != %d", n, len(recvBuffer))
+	packet := streamPacket{
+		PacketNumber: p[10],
+		ErrorCode:    ErrorCode(p[11]),
+		Backlog:      p[12+2*samplesPerPacket],
+		Samples:      make([]uint16, samplesPerPacket),
 	}
-
-	if normalChecksum8(recvBuffer[1:]) != recvBuffer[0] {
-		return ErrInvalidChecksumResponse
-	} else if recvBuffer[1] != 0xA9 || recvBuffer[3] != 0x00 {
-		return ErrInvalidResponseHeader
+	if packet.ErrorCode == ErrStreamAutoRecoverReport {
+		packet.Dropped = int(p[6]) + int(p[7])*256
 	}
-
-	errCode := recvBuffer[2]
-	if errCode != 0 {
-		return fmt.Errorf("Feedback response error code (%d)", errCode)
+	for i := range packet.Samples {
+		packet.Samples[i] = uint16(p[12+2*i]) + uint16(p[13+2*i])*256
 	}
-	return nil
+	return packet, nil
 }
 
-func (s *Stream) stop() error {
-	// s.stopCh <- struct{}{}
-
-	header := make([]byte, 2)
-	header[0] = 0xB0
-	header[1] = 0xB0
-	// fmt.Println("After header: ", sendBuffer.Bytes())
-
-	// Open USB interface
-	inf, done, err := s.device.device.DefaultInterface()
-	if err != nil {
-		return err
-	}
-	defer done()
+func (s *Stream) start(ctx context.Context) error {
 
-	// Open endpoint
-	out, err := inf.OutEndpoint(labjack.U6PipeOutEP1)
-	if err != nil {
-		return err
-	}
-
-	// Transmit send buffer
-	n, err := out.Write(header)
-	if err != nil {
+	// Transmit send buffer, read and validate response
+	recvBuffer := make([]byte, 4)
+	return s.device.command(ctx, frame.Normal(0xA8), recvBuffer, func(n int) error {
+		_, err := parseNormal(recvBuffer, n, 0xA9)
 		return err
-	} else if n != len(header) {
-		return errors.New("Send buffer was not written completely")
-	}
+	})
+}
 
-	// Open endpoint
-	in, err := inf.InEndpoint(labjack.U6PipeInEP2)
-	if err != nil {
-		return err
-	}
+func (s *Stream) stop(ctx context.Context) error {
 
-	// Read response
+	// Transmit send buffer, read and validate response
 	recvBuffer := make([]byte, 4)
-	n, err = in.Read(recvBuffer)
-	if err != nil {
+	return s.device.command(ctx, frame.Normal(0xB0), recvBuffer, func(n int) error {
+		_, err := parseNormal(recvBuffer, n, 0xB1)
+		if errors.Is(err, ErrStreamNotRunning) {
+			return nil
+		}
 		return err
-	} else if n != len(recvBuffer) {
-		// fmt.Printf("Recv buffer: %v\n", recvBuffer)
-		return fmt.Errorf("Full response was not recieved from device: %d != %d", n, len(recvBuffer))
-	}
-
-	checksumTotal8 := normalChecksum8(recvBuffer[1:])
-	if checksumTotal8 != recvBuffer[0] {
-		// fmt.Printf("Recv buffer: %v; checksum8=%d\n", recvBuffer, checksumTotal8)
-		return ErrInvalidChecksum8Response
-	} else if recvBuffer[1] != 0xB1 || recvBuffer[3] != 0x00 {
-		return ErrInvalidResponseHeader
-	}
-
-	errCode := recvBuffer[2]
-	if errCode != 0 && errCode != byte(52) {
-		return fmt.Errorf("Feedback response error code (%d)", errCode)
-	}
-	return nil
+	})
 }
 
+// Stop stops the stream. The in-flight read is aborted and the device is told
+// to stop streaming.
 func (s *Stream) Stop() {
-	s.stopCh <- struct{}{}
+	s.device.removeStream(s)
+	if s.cancel != nil {
+		s.cancel()
+	}
 }
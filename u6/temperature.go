@@ -0,0 +1,76 @@
+package u6
+
+import (
+	"context"
+	"io"
+)
+
+// TemperatureChannel is the analog input of the internal temperature sensor.
+const TemperatureChannel = 14
+
+// FeedbackTemperature is an AIN24 Feedback command reading the internal
+// temperature sensor on AIN14. It can be batched with other commands, such as
+// thermocouple readings which need the cold-junction temperature.
+type FeedbackTemperature struct {
+	ResolutionIndex int
+	SettlingFactor  int
+	responseBuffer  []byte
+	calInfo         CalibrationInfo
+}
+
+// WriteTo writes the AIN24 command for AIN14.
+func (f *FeedbackTemperature) WriteTo(w io.Writer) (int, error) {
+	ain := &FeedbackAIN24{PositiveChannel: TemperatureChannel, ResolutionIndex: f.ResolutionIndex, SettlingFactor: f.SettlingFactor}
+	return ain.WriteTo(w)
+}
+
+// ReadFrom reads the response.
+func (f *FeedbackTemperature) ReadFrom(r io.Reader) (int, error) {
+	f.responseBuffer = make([]byte, 3)
+	return io.ReadFull(r, f.responseBuffer)
+}
+
+// ResponseSize returns the response size.
+func (f *FeedbackTemperature) ResponseSize() int {
+	return 3
+}
+
+// SetCalibrationInfo sets the calibration info for calculating the proper values.
+func (f *FeedbackTemperature) SetCalibrationInfo(info CalibrationInfo) {
+	f.calInfo = info
+}
+
+// GetKelvin returns the temperature in Kelvin, converted with the temperature
+// slope and offset calibration constants.
+func (f *FeedbackTemperature) GetKelvin() (float64, error) {
+	if len(f.responseBuffer) < 3 {
+		return 0, ErrResponseTooShort
+	}
+
+	raw := uint(f.responseBuffer[0]) + uint(f.responseBuffer[1])*256 + uint(f.responseBuffer[2])*65536
+	volts, err := getCalibratedAIN(f.calInfo, f.ResolutionIndex, 0, true, raw)
+	if err != nil {
+		return 0, err
+	}
+	return volts*f.calInfo.CalConstants[22] + f.calInfo.CalConstants[23], nil
+}
+
+// GetCelsius returns the temperature in degrees Celsius.
+func (f *FeedbackTemperature) GetCelsius() (float64, error) {
+	kelvin, err := f.GetKelvin()
+	return kelvin - 273.15, err
+}
+
+// ReadTemperature reads the internal temperature of the U6 in Kelvin.
+func (u *U6) ReadTemperature() (float64, error) {
+	return u.ReadTemperatureContext(context.Background())
+}
+
+// ReadTemperatureContext is ReadTemperature with a context.
+func (u *U6) ReadTemperatureContext(ctx context.Context) (float64, error) {
+	temp := &FeedbackTemperature{ResolutionIndex: 8}
+	if err := u.FeedbackContext(ctx, temp); err != nil {
+		return 0, err
+	}
+	return temp.GetKelvin()
+}
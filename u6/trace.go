@@ -0,0 +1,148 @@
+package u6
+
+import (
+	"time"
+)
+
+// Logger receives the diagnostics of a U6. Its methods match those of
+// *slog.Logger, which satisfies it on Go 1.21 and later; the package itself
+// does not import log/slog.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(msg string, args ...interface{}) {}
+func (nopLogger) Info(msg string, args ...interface{})  {}
+func (nopLogger) Warn(msg string, args ...interface{})  {}
+func (nopLogger) Error(msg string, args ...interface{}) {}
+
+// Direction is the direction of a traced packet.
+type Direction int
+
+const (
+
+	// DirectionOut is a packet sent to the U6.
+	DirectionOut Direction = iota
+
+	// DirectionIn is a packet received from the U6.
+	DirectionIn
+)
+
+func (d Direction) String() string {
+	if d == DirectionOut {
+		return "out"
+	}
+	return "in"
+}
+
+// Trace describes a packet sent to or received from the U6.
+type Trace struct {
+	Direction Direction
+
+	// Command names the command of the packet, such as "Feedback" or "StreamData".
+	Command string
+
+	// Data is the packet. It must not be retained after the trace func returns.
+	Data []byte
+
+	// Time is when the transfer started and Duration how long it took.
+	Time     time.Time
+	Duration time.Duration
+
+	// Err is the transfer error, if any.
+	Err error
+}
+
+// TraceFunc receives every packet of a U6. It is called while the command
+// pipe is held and must not call methods of the U6.
+type TraceFunc func(Trace)
+
+// SetLogger sets the logger. A U6 is silent until a logger is set; nil
+// silences it again.
+func (u *U6) SetLogger(logger Logger) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if logger == nil {
+		logger = nopLogger{}
+	}
+	u.logger = logger
+}
+
+func (u *U6) log() Logger {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.logger == nil {
+		return nopLogger{}
+	}
+	return u.logger
+}
+
+// SetTrace sets the packet trace hook. nil disables tracing. A running stream
+// keeps the hook it was started with until it reconnects.
+func (u *U6) SetTrace(fn TraceFunc) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.trace = fn
+}
+
+func (u *U6) tracer() TraceFunc {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.trace
+}
+
+// tracePacket reports a packet to the trace hook, if any.
+func tracePacket(fn TraceFunc, dir Direction, p []byte, start time.Time, err error) {
+	if fn == nil {
+		return
+	}
+	fn(Trace{
+		Direction: dir,
+		Command:   CommandName(p),
+		Data:      p,
+		Time:      start,
+		Duration:  time.Since(start),
+		Err:       err,
+	})
+}
+
+// commandNames names the extended commands by command number.
+var commandNames = map[byte]string{
+	0x00: "Feedback",
+	0x08: "ConfigU6",
+	0x11: "StreamConfig",
+	0x2D: "ReadCal",
+}
+
+// CommandName names the command of a U6 packet, such as "Feedback" or
+// "StreamStart". Unknown commands are named "Unknown".
+func CommandName(p []byte) string {
+	if len(p) < 2 {
+		return "Unknown"
+	} else if p[0] == 0xB8 && p[1] == 0xB8 {
+		return "BadChecksum"
+	}
+
+	switch p[1] {
+	case 0xA8, 0xA9:
+		return "StreamStart"
+	case 0xB0, 0xB1:
+		return "StreamStop"
+	case 0xF9:
+		return "StreamData"
+	case 0xF8:
+		if len(p) > 3 {
+			if name, ok := commandNames[p[3]]; ok {
+				return name
+			}
+		}
+	}
+	return "Unknown"
+}
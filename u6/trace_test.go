@@ -0,0 +1,89 @@
+package u6_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/eliquious/labjack/u6"
+)
+
+// recordingLogger keeps the logged messages.
+type recordingLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *recordingLogger) log(msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages = append(l.messages, msg)
+}
+
+func (l *recordingLogger) Debug(msg string, args ...interface{}) { l.log(msg) }
+func (l *recordingLogger) Info(msg string, args ...interface{})  { l.log(msg) }
+func (l *recordingLogger) Warn(msg string, args ...interface{})  { l.log(msg) }
+func (l *recordingLogger) Error(msg string, args ...interface{}) { l.log(msg) }
+
+func Test_Trace(t *testing.T) {
+	_, dev := openSimulator(t)
+	defer dev.Close()
+
+	var traces []u6.Trace
+	dev.SetTrace(func(trace u6.Trace) {
+		trace.Data = append([]byte(nil), trace.Data...)
+		traces = append(traces, trace)
+	})
+
+	if err := dev.Feedback(&u6.FeedbackBitStateRead{BitNumber: u6.FIO0}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(traces) != 2 {
+		t.Fatalf("Expected 2 traces; got %d", len(traces))
+	} else if traces[0].Direction != u6.DirectionOut || traces[0].Command != "Feedback" || len(traces[0].Data) != 10 {
+		t.Fatalf("Invalid command trace: %+v", traces[0])
+	} else if traces[1].Direction != u6.DirectionIn || traces[1].Command != "Feedback" || len(traces[1].Data) != 10 {
+		t.Fatalf("Invalid response trace: %+v", traces[1])
+	}
+
+	dev.SetTrace(nil)
+	if err := dev.Feedback(&u6.FeedbackBitStateRead{BitNumber: u6.FIO0}); err != nil {
+		t.Fatal(err)
+	} else if len(traces) != 2 {
+		t.Fatalf("Trace was not disabled: %d traces", len(traces))
+	}
+}
+
+func Test_Logger(t *testing.T) {
+	sim, dev := openSimulator(t)
+	defer dev.Close()
+
+	logger := &recordingLogger{}
+	dev.SetLogger(logger)
+
+	sim.CorruptResponses(1)
+	if err := dev.Feedback(&u6.FeedbackBitStateRead{BitNumber: u6.FIO0}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(logger.messages) != 1 || logger.messages[0] != "Retrying command" {
+		t.Fatalf("Invalid log messages: %v", logger.messages)
+	}
+}
+
+func Test_CommandName(t *testing.T) {
+	names := map[string][]byte{
+		"StreamStart": {0xA8, 0xA8},
+		"StreamStop":  {0xB1, 0xB1, 0, 0},
+		"ConfigU6":    {0, 0xF8, 0x0A, 0x08},
+		"ReadCal":     {0, 0xF8, 0x01, 0x2D},
+		"StreamData":  {0, 0xF9, 0x04, 0xC0},
+		"BadChecksum": {0xB8, 0xB8},
+		"Unknown":     {0x01},
+	}
+	for expected, packet := range names {
+		if name := u6.CommandName(packet); name != expected {
+			t.Errorf("Expected %s; got %s", expected, name)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package u6
+
+import "context"
+
+// Transport carries packets between the driver and a U6. Commands are written
+// to the command pipe (EP1), responses are read from the response pipe (EP2)
+// and stream data is read from the stream pipe (EP3). Transfers must return
+// once the context is done.
+type Transport interface {
+
+	// Write sends a command packet on the command pipe.
+	Write(ctx context.Context, p []byte) (int, error)
+
+	// Read reads a command response from the response pipe.
+	Read(ctx context.Context, p []byte) (int, error)
+
+	// OpenStream opens the stream pipe. Each bulk transfer is transferSize bytes.
+	OpenStream(transferSize int) (StreamReader, error)
+
+	// Close releases the underlying connection.
+	Close() error
+}
+
+// StreamReader reads data packets from the stream pipe.
+type StreamReader interface {
+	Read(ctx context.Context, p []byte) (int, error)
+	Close() error
+}
+
+// readFull reads exactly len(p) bytes from the stream.
+func readFull(ctx context.Context, r StreamReader, p []byte) (int, error) {
+	var n int
+	for n < len(p) {
+		nn, err := r.Read(ctx, p[n:])
+		n += nn
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
@@ -2,214 +2,204 @@ package u6
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/eliquious/labjack"
+	"github.com/eliquious/labjack/frame"
 	"github.com/google/gousb"
+	"sync"
+	"time"
 	// "io"
 )
 
 // OpenUSBConnection opens the USB connection a LabJack U6.
-func OpenUSBConnection(usbctx *gousb.Context) (*U6, error) {
+func OpenUSBConnection(usbctx *gousb.Context, opts ...Option) (*U6, error) {
+	return OpenUSBConnectionContext(context.Background(), usbctx, opts...)
+}
+
+// OpenUSBConnectionContext opens the USB connection a LabJack U6. The context
+// bounds the device initialization.
+func OpenUSBConnectionContext(ctx context.Context, usbctx *gousb.Context, opts ...Option) (*U6, error) {
 	if usbctx == nil {
 		return &emptyU6, ErrInvalidContext
 	}
 
+	o := newOptions(opts)
+	if o.serial != 0 {
+		dev, err := findUSBDevice(ctx, usbctx, func(*gousb.DeviceDesc) bool { return true }, func(desc DeviceDesc) bool {
+			return desc.SerialNumber == o.serial
+		})
+		if err != nil {
+			return &emptyU6, err
+		}
+		return openUSBDevice(ctx, dev, o)
+	}
+
 	// Open any device with a given VID/PID using a convenience function.
 	dev, err := usbctx.OpenDeviceWithVIDPID(labjack.LabJackVendorID, labjack.U6ProductID)
 	if err != nil {
 		return &emptyU6, ErrLibUSB{"Could not open a device", err}
+	} else if dev == nil {
+		return &emptyU6, ErrDeviceNotFound
 	}
-	if err := dev.Reset(); err != nil {
-		return &emptyU6, err
-	}
-	if err := dev.SetAutoDetach(true); err != nil {
-		return &emptyU6, err
-	}
+	return openUSBDevice(ctx, dev, o)
+}
+
+// Open initializes a U6 over the given transport.
+func Open(t Transport, opts ...Option) (*U6, error) {
+	return OpenContext(context.Background(), t, opts...)
+}
 
-	ljdev := &U6{dev, DeviceDesc{}, DefaultCalibrationInfo}
-	if err = ljdev.initConnection(); err != nil {
+// OpenContext initializes a U6 over the given transport. The context bounds the
+// device initialization.
+func OpenContext(ctx context.Context, t Transport, opts ...Option) (*U6, error) {
+	return openContext(ctx, t, newOptions(opts))
+}
+
+func openContext(ctx context.Context, t Transport, o options) (*U6, error) {
+	ljdev := &U6{
+		transport:    t,
+		calibration:  DefaultCalibrationInfo,
+		policy:       o.policy,
+		logger:       o.logger,
+		options:      o,
+		reconnecting: make(chan struct{}, 1),
+		streams:      make(map[*Stream]struct{}),
+	}
+	if err := ljdev.initConnection(ctx); err != nil {
+		ljdev.log().Warn("Failed to open U6", "error", err)
 		return &emptyU6, err
+	} else if o.serial != 0 && ljdev.config.SerialNumber != o.serial {
+		ljdev.log().Debug("Skipped U6", "serial", ljdev.config.SerialNumber, "expected", o.serial)
+		return &emptyU6, ErrDeviceNotFound
 	}
 
-	if err = ljdev.getCalibrationInfo(); err != nil {
+	calibration := "provided"
+	if o.calibration != nil {
+		ljdev.calibration = *o.calibration
+	} else if err := ljdev.getCalibrationInfo(ctx); err != nil {
+		ljdev.log().Warn("Failed to read U6 calibration", "serial", ljdev.config.SerialNumber, "error", err)
 		return &emptyU6, err
+	} else {
+		calibration = "device"
 	}
+
+	ljdev.log().Info("Opened U6", "serial", ljdev.config.SerialNumber, "type", ljdev.config.DeviceType,
+		"firmware", ljdev.config.FirmwareVersion, "calibration", calibration)
 	return ljdev, nil
 }
 
 var emptyU6 U6
 
-// U6 represents the LabJack U6 / U6 Pro devices
+// U6 represents the LabJack U6 / U6 Pro devices. A U6 is safe for concurrent
+// use by multiple goroutines: command/response transactions are serialized on
+// the command pipe while stream data arrives on its own pipe, so Feedback may be
+// called while a Stream is running.
 type U6 struct {
-	device      *gousb.Device
+
+	// pipe serializes the transactions on the command pipe. mu guards the
+	// state below and is never held during USB transfers. pipe is locked
+	// before mu.
+	pipe        sync.Mutex
+	mu          sync.Mutex
+	unread      bool
+	policy      RetryPolicy
+	transport   Transport
 	config      DeviceDesc
 	calibration CalibrationInfo
+
+	logger  Logger
+	trace   TraceFunc
+	metrics metrics
+
+	// options are the open options. They do not change once opened.
+	options options
+
+	// Reconnection state, see SetReconnect.
+	reconnect    *ReconnectConfig
+	reconnecting chan struct{}
+	generation   int
+	lost         bool
+	outputs      outputState
+	streams      map[*Stream]struct{}
 }
 
 // DeviceDesc returns the device details.
 func (u *U6) DeviceDesc() DeviceDesc {
+	u.mu.Lock()
+	defer u.mu.Unlock()
 	return u.config
 }
 
-func (u *U6) initConnection() error {
-	sendBuffer := make([]byte, 26)
-	recBuffer := make([]byte, 38)
-
-	// setting up U6Config
-	sendBuffer[1] = uint8(0xF8)
-	sendBuffer[2] = uint8(0x0A)
-	sendBuffer[3] = uint8(0x08)
-
-	for i := 6; i < 26; i++ {
-		sendBuffer[i] = uint8(0x00)
-	}
-	extendedChecksum(sendBuffer)
-
-	// Open USB interface
-	inf, done, err := u.device.DefaultInterface()
+func (u *U6) initConnection(ctx context.Context) error {
+	recBuffer, err := u.configU6(ctx)
 	if err != nil {
 		return err
 	}
-	defer done()
-
-	// Open endpoint
-	out, err := inf.OutEndpoint(labjack.U6PipeOutEP1)
-	if err != nil {
-		return err
-	}
-
-	// Transmit send buffer
-	n, err := out.Write(sendBuffer)
-	if err != nil {
-		return err
-	} else if n != len(sendBuffer) {
-		return ErrEndpointSendError
-	}
-
-	// Open endpoint
-	in, err := inf.InEndpoint(labjack.U6PipeInEP2)
-	if err != nil {
-		return err
-	}
-
-	// Read response
-	n, err = in.Read(recBuffer)
-	if err != nil {
-		return err
-	} else if n != len(recBuffer) {
-		return ErrEndpointRecvError
-	}
-
-	// Validate response
-	if err = validateCommandResponse(recBuffer); err != nil {
-		return err
-	}
 
 	// Parse device info
 	config, err := parseConfigBytes(recBuffer)
 	if err != nil {
 		return err
 	}
+	u.mu.Lock()
 	u.config = config
+	u.mu.Unlock()
 
 	return nil
 }
 
-func validateCommandResponse(recBuffer []uint8) error {
-	if len(recBuffer) < 7 {
-		return ErrResponseTooShort
-	}
-
-	// Bad checksum response
-	if recBuffer[0] == 0xB8 && recBuffer[1] == 0xB8 {
-		return ErrInvalidChecksumResponse
-	}
-
-	// Validate response header
-	if recBuffer[1] != uint8(0xF8) || recBuffer[2] != uint8(0x10) ||
-		recBuffer[3] != uint8(0x08) {
-		return ErrInvalidResponseHeader
-	} else if recBuffer[6] != 0 {
-		return ErrLabJackErrorCode{int(recBuffer[6])}
-	}
-
-	// Validate response
-	checksumTotal, err := extendedChecksum16(recBuffer)
+// configU6 reads the ConfigU6 response without changing the configuration.
+func (u *U6) configU6(ctx context.Context) ([]byte, error) {
+	sendBuffer, err := frame.Extended(0x08, make([]byte, 20))
 	if err != nil {
-		return err
-	} else if uint8((checksumTotal/256)&0xFF) != recBuffer[5] {
-		fmt.Printf("ErrInvalidChecksum MSB: %s != %s\n", uint8((checksumTotal/256)&0xFF), recBuffer[5])
-		return ErrInvalidChecksum
-	} else if uint8(checksumTotal&0xFF) != recBuffer[4] {
-		fmt.Printf("ErrInvalidChecksum LSB: %s != %s\n", uint8((checksumTotal)&0xFF), recBuffer[4])
-		return ErrInvalidChecksum
+		return nil, err
 	}
 
-	c, err := extendedChecksum8(recBuffer)
-	if err != nil {
+	// Transmit send buffer, read and validate response
+	recBuffer := make([]byte, 38)
+	err = u.command(ctx, sendBuffer, recBuffer, func(n int) error {
+		_, err := parseExtended(recBuffer, n, 0x08)
 		return err
-	} else if c != recBuffer[0] {
-		fmt.Printf("ErrInvalidChecksum 8-bit: %d != %d\n", c, recBuffer[0])
-		return ErrInvalidChecksum
-	}
-
-	return nil
+	})
+	return recBuffer, err
 }
 
-// GetCalibrationInfo gets the calibration information for the device
-func (u *U6) getCalibrationInfo() error {
-	sendBuffer := make([]byte, 64)
-	recBuffer := make([]byte, 64)
-
-	// setting up U6Config
-	sendBuffer[1] = uint8(0xF8)
-	sendBuffer[2] = uint8(0x0A)
-	sendBuffer[3] = uint8(0x08)
-
-	for i := 6; i < 26; i++ {
-		sendBuffer[i] = uint8(0x00)
-	}
-	extendedChecksum(sendBuffer[:26])
-
-	// Open USB interface
-	inf, done, err := u.device.DefaultInterface()
-	if err != nil {
-		return err
-	}
-	defer done()
-
-	// Open endpoint
-	out, err := inf.OutEndpoint(labjack.U6PipeOutEP1)
-	if err != nil {
-		return err
+// parseExtended validates the extended response read into p[:n]. The
+// response must fill p.
+func parseExtended(p []byte, n int, command byte) (frame.Response, error) {
+	resp, err := frame.ParseExtended(p[:n], command)
+	if err == nil && n != len(p) {
+		err = fmt.Errorf("%w: %d != %d", ErrEndpointRecvError, n, len(p))
 	}
+	return resp, responseError(err)
+}
 
-	// Transmit send buffer
-	n, err := out.Write(sendBuffer[:26])
-	if err != nil {
-		return err
-	} else if n != 26 {
-		return ErrEndpointSendError
+// parseNormal validates the normal response read into p[:n]. The response
+// must fill p.
+func parseNormal(p []byte, n int, command byte) (frame.Response, error) {
+	resp, err := frame.ParseNormal(p[:n], command)
+	if err == nil && n != len(p) {
+		err = fmt.Errorf("%w: %d != %d", ErrEndpointRecvError, n, len(p))
 	}
+	return resp, responseError(err)
+}
 
-	// Open endpoint
-	in, err := inf.InEndpoint(labjack.U6PipeInEP2)
-	if err != nil {
-		return err
+// responseError converts the error codes reported by the U6.
+func responseError(err error) error {
+	var code frame.ErrorCode
+	if errors.As(err, &code) {
+		return ErrorCode(code)
 	}
+	return err
+}
 
-	// Read response
-	n, err = in.Read(recBuffer[:38])
+// GetCalibrationInfo gets the calibration information for the device
+func (u *U6) getCalibrationInfo(ctx context.Context) error {
+	recBuffer, err := u.configU6(ctx)
 	if err != nil {
 		return err
-	} else if n != 38 {
-		return ErrEndpointRecvError
-	}
-
-	// Validate response
-	if err = validateCommandResponse(recBuffer); err != nil {
-		return err
 	}
 
 	cal := CalibrationInfo{
@@ -221,202 +211,380 @@ func (u *U6) getCalibrationInfo() error {
 	for i := 0; i < 10; i++ {
 
 		/* reading block i from memory */
-		sendBuffer[1] = uint8(0xF8) //command byte
-		sendBuffer[2] = uint8(0x01) //number of data words
-		sendBuffer[3] = uint8(0x2D) //extended command number
-		sendBuffer[6] = 0
-		sendBuffer[7] = uint8(i) //Blocknum = i
-		// extendedChecksum(sendBuffer[:8])
-		setChecksum(sendBuffer[:8])
-		// fmt.Println("Sent: ", sendBuffer[:8])
-
-		// Transmit send buffer
-		n, err := out.Write(sendBuffer[:8])
+		sendBuffer, err := frame.Extended(0x2D, []byte{0, byte(i)})
 		if err != nil {
 			return err
-		} else if n != 8 {
-			return ErrEndpointSendError
 		}
 
-		// Read response
-		n, err = in.Read(recBuffer[:40])
+		// Transmit send buffer, read and validate response
+		recBuffer := make([]byte, 40)
+		err = u.command(ctx, sendBuffer, recBuffer, func(n int) error {
+			_, err := parseExtended(recBuffer, n, 0x2D)
+			return err
+		})
 		if err != nil {
 			return err
-		} else if recBuffer[0] == 0xB8 && recBuffer[1] == 0xB8 {
-			// Bad checksum response
-			return ErrInvalidChecksumResponse
-		} else if n != 40 {
-			// fmt.Printf("Error reading response: n=%d; i=%d; offset=%d\n", n, i, offset)
-			return ErrEndpointRecvError
-		}
-		// fmt.Println("Recv'd: ", recBuffer[:40])
-
-		if recBuffer[1] != uint8(0xF8) || recBuffer[2] != uint8(0x11) || recBuffer[3] != uint8(0x2D) {
-			return ErrInvalidResponseHeader
 		}
 		offset = i * 4
 
 		//block data starts on byte 8 of the buffer
-		cal.CalConstants[offset] = uint8ArrayToFloat64(recBuffer[8:], 0)
-		// fmt.Println(recBuffer[8:16])
-		cal.CalConstants[offset+1] = uint8ArrayToFloat64(recBuffer[8:], 8)
-		// fmt.Println(recBuffer[16:24])
-		cal.CalConstants[offset+2] = uint8ArrayToFloat64(recBuffer[8:], 16)
-		// fmt.Println(recBuffer[24:32])
-		cal.CalConstants[offset+3] = uint8ArrayToFloat64(recBuffer[8:], 24)
-		// fmt.Println(recBuffer[32:40])
+		copy(cal.CalConstants[offset:offset+4], calibrationBlock(recBuffer))
 	}
+	u.mu.Lock()
 	u.calibration = cal
+	u.mu.Unlock()
 
 	return nil
 }
 
+// calibrationBlock decodes the four calibration constants of a ReadCal
+// response.
+func calibrationBlock(recBuffer []byte) []float64 {
+	block := make([]float64, 4)
+	for i := range block {
+		block[i] = uint8ArrayToFloat64(recBuffer[8:], i*8)
+	}
+	return block
+}
+
 // GetCalibrationInfo gets the calibration information for the device
 func (u *U6) GetCalibrationInfo() CalibrationInfo {
+	u.mu.Lock()
+	defer u.mu.Unlock()
 	return u.calibration
 }
 
 // Close closes the device connection.
 func (u *U6) Close() error {
-	return u.device.Close()
-}
+	u.pipe.Lock()
+	defer u.pipe.Unlock()
+	u.mu.Lock()
+	defer u.mu.Unlock()
 
-var feedbackHeader = []byte{0, 0xF8, 0, 0, 0, 0, 0}
+	u.reconnect = nil
+	if u.lost {
+		// The transport was closed when the device was lost
+		return nil
+	}
+	return u.transport.Close()
+}
 
-// Feedback executes all of the Feedback commands given.
-func (u *U6) Feedback(cmds ...FeedbackCommand) error {
-	var sendBuffer bytes.Buffer
+// command executes a transaction and validates the response, retrying
+// according to the retry policy. validate is given the number of response
+// bytes read. If the device is disconnected and reconnection is enabled, the
+// command is retried once the device is back.
+func (u *U6) command(ctx context.Context, send, recv []byte, validate func(n int) error) error {
+	return u.commandOutput(ctx, send, recv, false, validate)
+}
 
-	// Write header
-	n, err := sendBuffer.Write(feedbackHeader)
-	if err != nil {
-		return err
-	} else if n != len(feedbackHeader) {
-		return errors.New("Feedback header could not be written")
-	}
-	// fmt.Println("After header: ", sendBuffer.Bytes())
+// commandOutput is command for commands which change outputs if output is set.
+// They are only retried if they were not executed, see IsRetryableOutput.
+func (u *U6) commandOutput(ctx context.Context, send, recv []byte, output bool, validate func(n int) error) error {
+	start := time.Now()
+	err := u.retry(ctx, send, recv, output, validate)
+	u.metrics.command(CommandName(send), time.Since(start), err)
+	return err
+}
 
-	// Write each feeback command
-	var length int
-	var responseSize int
-	for _, cmd := range cmds {
-		cmd.SetCalibrationInfo(u.calibration)
-		n, err := cmd.WriteTo(&sendBuffer)
-		if err != nil {
+// retry executes the transaction of a command until it succeeds or may not
+// be retried.
+func (u *U6) retry(ctx context.Context, send, recv []byte, output bool, validate func(n int) error) error {
+	policy := u.RetryPolicy()
+	backoff := policy.Backoff
+	for attempt := 0; ; attempt++ {
+		gen := u.connection()
+		n, err := u.transaction(ctx, policy, send, recv)
+		if errors.Is(err, ErrDeviceDisconnected) && u.recover(ctx, gen) {
+			attempt--
+			continue
+		} else if err == nil {
+			err = validate(n)
+		}
+		if err == nil {
+			return nil
+		} else if attempt >= policy.MaxRetries || ctx.Err() != nil || !policy.retryable(err, output) {
+			u.metrics.failed(err, false)
 			return err
-		} else if n == 0 {
-			return errors.New("Command data was not written")
 		}
-		length += n
-		responseSize += cmd.ResponseSize()
+		u.metrics.failed(err, true)
+		u.log().Debug("Retrying command", "command", CommandName(send), "attempt", attempt+1, "error", err)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		backoff *= 2
 	}
-	// fmt.Println("After commands: ", sendBuffer.Bytes())
+}
 
-	// Pad message if needed
-	if (length+1)%2 == 1 {
-		if err = sendBuffer.WriteByte(0x00); err != nil {
-			return err
+// transaction writes a command and reads its response while holding the
+// command pipe. It returns the number of response bytes read.
+func (u *U6) transaction(ctx context.Context, policy RetryPolicy, send, recv []byte) (int, error) {
+	u.pipe.Lock()
+	defer u.pipe.Unlock()
+
+	u.mu.Lock()
+	lost, unread, t, trace := u.lost, u.unread, u.transport, u.trace
+	u.mu.Unlock()
+
+	if lost {
+		return 0, ErrDeviceDisconnected
+	} else if unread {
+		if err := u.drain(ctx, t, trace); err != nil {
+			return 0, err
 		}
-		length++
 	}
-	// fmt.Println("After padding: ", sendBuffer.Bytes())
 
-	// Get bytes and set word count
-	buf := sendBuffer.Bytes()
-	buf[2] = byte(length+1) / 2
-	// fmt.Println("After word count: ", sendBuffer.Bytes())
+	start := time.Now()
+	wctx, cancel := withTimeout(ctx, policy.WriteTimeout)
+	n, err := t.Write(wctx, send)
+	cancel()
+	tracePacket(trace, DirectionOut, send[:n], start, err)
+	if err != nil {
+		return 0, err
+	} else if n != len(send) {
+		return 0, ErrEndpointSendError
+	}
+
+	start = time.Now()
+	rctx, cancel := withTimeout(ctx, policy.ReadTimeout)
+	n, err = t.Read(rctx, recv)
+	cancel()
+	tracePacket(trace, DirectionIn, recv[:n], start, err)
+	u.metrics.transaction(len(send), n)
+	if err != nil && rctx.Err() != nil {
+		// The command was sent but its response was abandoned.
+		u.mu.Lock()
+		u.unread = true
+		u.mu.Unlock()
+	}
+	return n, err
+}
 
-	// Calculate checksum
-	if err = setChecksum(buf); err != nil {
+// drainTimeout is how long to wait for the response of an abandoned command.
+const drainTimeout = 100 * time.Millisecond
+
+// drain discards the response of an abandoned command so it is not taken for
+// the response of the next one.
+func (u *U6) drain(ctx context.Context, t Transport, trace TraceFunc) error {
+	dctx, cancel := context.WithTimeout(ctx, drainTimeout)
+	defer cancel()
+
+	buf := make([]byte, 64)
+	start := time.Now()
+	n, err := t.Read(dctx, buf)
+	tracePacket(trace, DirectionIn, buf[:n], start, err)
+	if err := ctx.Err(); err != nil {
 		return err
 	}
-	fmt.Printf("After checksum: %v\n", buf)
+	u.log().Debug("Discarded abandoned response", "bytes", n)
 
-	// Open USB interface
-	inf, done, err := u.device.DefaultInterface()
-	if err != nil {
-		return err
+	u.mu.Lock()
+	u.unread = false
+	u.mu.Unlock()
+	return nil
+}
+
+// Feedback executes all of the Feedback commands given.
+func (u *U6) Feedback(cmds ...FeedbackCommand) error {
+	return u.FeedbackContext(context.Background(), cmds...)
+}
+
+// FeedbackContext executes all of the Feedback commands given. If the context
+// is done before the response arrives, the commands may or may not have been
+// executed by the device. Output commands fail with ErrReadOnly if the U6 was
+// opened with WithReadOnly.
+//
+// Commands which do not fit the 64 byte command and response frames are split
+// into as few packets as possible and executed in order. If a packet fails,
+// the commands of the previous packets were executed.
+func (u *U6) FeedbackContext(ctx context.Context, cmds ...FeedbackCommand) error {
+	if u.options.readOnly {
+		for _, cmd := range cmds {
+			if _, ok := cmd.(outputCommand); ok {
+				return ErrReadOnly
+			}
+		}
 	}
-	defer done()
 
-	// Open endpoint
-	out, err := inf.OutEndpoint(labjack.U6PipeOutEP1)
+	// Write each feeback command
+	packets, err := splitFeedback(cmds, u.GetCalibrationInfo())
 	if err != nil {
 		return err
 	}
 
-	// Transmit send buffer
-	n, err = out.Write(buf)
-	if err != nil {
-		return err
-	} else if n != len(buf) {
-		return errors.New("Send buffer was not written completely")
+	for _, p := range packets {
+		err := u.sendFeedback(ctx, cmds[p.start:p.end], p.data, p.ioTypes, p.responseSize)
+		var ferr *FeedbackError
+		if errors.As(err, &ferr) && ferr.Command != nil {
+
+			// The commands of the previous packets were executed as well
+			populated := len(ferr.Populated) == len(ferr.Executed)
+			ferr.Index += p.start
+			ferr.Executed = cmds[:ferr.Index]
+			ferr.Populated = cmds[:p.start]
+			if populated {
+				ferr.Populated = ferr.Executed
+			}
+			return ferr
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const (
+
+	// maxFeedbackData is the maximum size of the echo byte and commands of a
+	// Feedback packet, limited by the 64 byte command frame.
+	maxFeedbackData = 64 - frame.HeaderSize
+
+	// maxFeedbackResponse is the maximum response size of the commands of a
+	// Feedback packet, limited by the 64 byte response frame.
+	maxFeedbackResponse = 64 - 9
+)
+
+// feedbackPacket is a Feedback packet of the commands cmds[start:end].
+type feedbackPacket struct {
+	start, end   int
+	data         []byte
+	ioTypes      []byte
+	responseSize int
+}
+
+// splitFeedback encodes the commands into the fewest Feedback packets,
+// keeping the order of the commands.
+func splitFeedback(cmds []FeedbackCommand, cal CalibrationInfo) ([]feedbackPacket, error) {
+	var packets []feedbackPacket
+	p := feedbackPacket{data: []byte{0}}
+	for i, cmd := range cmds {
+		var data bytes.Buffer
+		cmd.SetCalibrationInfo(cal)
+		n, err := cmd.WriteTo(&data)
+		if err != nil {
+			return nil, err
+		} else if n == 0 {
+			return nil, errors.New("Command data was not written")
+		}
+
+		size := cmd.ResponseSize()
+		if 1+data.Len() > maxFeedbackData || size > maxFeedbackResponse {
+			return nil, fmt.Errorf("Feedback command %d (%s) exceeds the packet size", i, ioTypeName(data.Bytes()[0]))
+		} else if len(p.data)+data.Len() > maxFeedbackData || p.responseSize+size > maxFeedbackResponse {
+			packets = append(packets, p)
+			p = feedbackPacket{start: i, end: i, data: []byte{0}}
+		}
+
+		p.data = append(p.data, data.Bytes()...)
+		p.ioTypes = append(p.ioTypes, data.Bytes()[0])
+		p.responseSize += size
+		p.end++
 	}
+	return append(packets, p), nil
+}
 
-	// Open endpoint
-	in, err := inf.InEndpoint(labjack.U6PipeInEP2)
+// sendFeedback executes the commands of one Feedback packet.
+func (u *U6) sendFeedback(ctx context.Context, cmds []FeedbackCommand, data, ioTypes []byte, responseSize int) error {
+	buf, err := frame.Extended(0x00, data)
 	if err != nil {
 		return err
 	}
 
-	// Read response
+	// Transmit send buffer, read and validate response
+	var output bool
+	for _, cmd := range cmds {
+		if _, ok := cmd.(outputCommand); ok {
+			output = true
+		}
+	}
+
+	var received int
 	recvBuffer := make([]byte, 9+responseSize)
-	n, err = in.Read(recvBuffer)
-	if err != nil {
+	err = u.commandOutput(ctx, buf, recvBuffer, output, func(n int) error {
+		resp, err := parseExtended(recvBuffer, n, 0x00)
+		var code ErrorCode
+		if errors.As(err, &code) && len(resp.Data) > 1 {
+
+			// Byte 7 is the frame of the failed command
+			received = n
+			return newFeedbackError(cmds, ioTypes, int(resp.Data[1]), code)
+		}
 		return err
-	} else if n != len(recvBuffer) {
-		// fmt.Printf("Recv buffer: %v\n", recvBuffer)
-		return fmt.Errorf("Full response was not recieved from device: %d != %d", n, len(recvBuffer))
-	}
+	})
 
-	checksumTotal, err := extendedChecksum16(recvBuffer)
-	if err != nil {
+	var ferr *FeedbackError
+	if errors.As(err, &ferr) && ferr.Command != nil {
+
+		// The commands before the failed one were executed
+		ferr.Executed = cmds[:ferr.Index]
+		u.recordOutputs(ferr.Executed)
+		if _, err := populate(ferr.Executed, recvBuffer[9:received]); err == nil {
+			ferr.Populated = ferr.Executed
+		}
+		return ferr
+	} else if err != nil {
 		return err
-	} else if byte((checksumTotal/256)&0xFF) != recvBuffer[5] {
-		return ErrInvalidChecksumResponse
-	} else if byte(checksumTotal&0xFF) != recvBuffer[4] {
-		return ErrInvalidChecksumResponse
-	} else if recvBuffer[1] != 0xF8 || recvBuffer[3] != 0x00 {
-		return ErrInvalidResponseHeader
-	} else if recvBuffer[6] != 0x00 {
-		return ErrInvalidResponseHeader
 	}
 
-	c8, err := extendedChecksum8(recvBuffer)
+	// Populate the commands' response
+	remaining, err := populate(cmds, recvBuffer[9:])
 	if err != nil {
 		return err
-	} else if c8 != recvBuffer[0] {
-		return ErrInvalidResponseHeader
+	} else if remaining != 0 {
+		return fmt.Errorf("Feedback response was not decoded completely: remaining=%d", remaining)
 	}
-	// fmt.Println("Recv Buffer: ", recvBuffer)
 
-	errCode := recvBuffer[6]
-	errFrame := recvBuffer[7]
-	if errCode != 0 {
-		return fmt.Errorf("Feedback response error code (%d): command=%d", errCode, errFrame)
+	u.recordOutputs(cmds)
+	return nil
+}
+
+// populate reads the commands' responses from data and returns the number of
+// bytes left over.
+func populate(cmds []FeedbackCommand, data []byte) (int, error) {
+	var size int
+	for _, cmd := range cmds {
+		size += cmd.ResponseSize()
+	}
+	if size > len(data) {
+		return 0, ErrResponseTooShort
 	}
 
-	// Populate the commands' response
-	remaining := int64(len(recvBuffer) - 9)
-	buffer := bytes.NewBuffer(recvBuffer[9:])
+	remaining := len(data)
+	buffer := bytes.NewBuffer(data)
 	for _, cmd := range cmds {
 
 		num, err := cmd.ReadFrom(buffer)
 		if err != nil {
-			return err
+			return remaining, err
 		}
-		remaining -= int64(num)
+		remaining -= num
 	}
+	return remaining, nil
+}
 
-	if remaining != 0 {
-		return fmt.Errorf("Feedback response was not decoded completely: remaining=%d", remaining)
+// recordOutputs remembers the outputs for restoring them after a reconnect.
+func (u *U6) recordOutputs(cmds []FeedbackCommand) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, cmd := range cmds {
+		if o, ok := cmd.(outputCommand); ok {
+			o.applyOutput(&u.outputs)
+		}
 	}
-	return nil
 }
 
 // NewStream creates a new data stream
 func (u *U6) NewStream(config *StreamConfig) (*Stream, error) {
-	stream := &Stream{u, config, make(chan struct{}, 1), func() {}}
+	return u.NewStreamContext(context.Background(), config)
+}
+
+// NewStreamContext creates a new data stream. The context bounds the stream configuration.
+func (u *U6) NewStreamContext(ctx context.Context, config *StreamConfig) (*Stream, error) {
+	stream := &Stream{device: u, config: config}
 	if config.SamplesPerPacket < 1 || config.SamplesPerPacket > 25 {
 		return stream, errors.New("Invalid samples per packet")
 	} else if config.ResolutionIndex < 1 || config.ResolutionIndex > 8 {
@@ -443,96 +611,26 @@ func (u *U6) NewStream(config *StreamConfig) (*Stream, error) {
 		config.SamplesPerPacket = 1
 	}
 
-	header := make([]byte, 14+2*len(config.Channels))
-	header[1] = 0xF8
-	header[2] = byte(len(config.Channels) + 4)
-	header[3] = 0x11
-	header[6] = byte(len(config.Channels))
-	header[7] = byte(config.ResolutionIndex)
-	header[8] = byte(config.SamplesPerPacket)
-	header[10] = byte(config.SettlingFactor)
-	header[11] = config.ScanConfig.GetByte()
-
-	// // scanInterval := 4000
-	// if config.ScanConfig.ClockSpeed == ClockSpeed48Mhz {
-	// 	// scanInterval = 48000
-	// }
-	header[12] = byte(config.ScanConfig.ScanInterval & 0x00FF)
-	header[13] = byte(config.ScanConfig.ScanInterval / 256)
-
-	for i, ch := range config.Channels {
-		header[14+i*2] = ch.PositiveChannel
-		header[15+i*2] = byte(ch.Differential) + byte(ch.GainIndex)<<4
-	}
-	// fmt.Println("After header: ", sendBuffer.Bytes())
-
-	// Calculate checksum
-	if err := setChecksum(header); err != nil {
-		return stream, err
-	}
-	// fmt.Printf("After checksum: %v\n", header)
-
-	// Open USB interface
-	inf, done, err := u.device.DefaultInterface()
+	data := config.bytes()
+	header, err := frame.Extended(0x11, data)
 	if err != nil {
 		return stream, err
 	}
-	defer done()
 
-	// Open endpoint
-	out, err := inf.OutEndpoint(labjack.U6PipeOutEP1)
-	if err != nil {
+	stream.header = header
+	if err := u.configureStream(ctx, header); err != nil {
 		return stream, err
 	}
+	return stream, nil
+}
 
-	// Transmit send buffer
-	n, err := out.Write(header)
-	if err != nil {
-		return stream, err
-	} else if n != len(header) {
-		return stream, errors.New("Send buffer was not written completely")
-	}
-
-	// Open endpoint
-	in, err := inf.InEndpoint(labjack.U6PipeInEP2)
-	if err != nil {
-		return stream, err
-	}
+// configureStream sends the StreamConfig command.
+func (u *U6) configureStream(ctx context.Context, header []byte) error {
 
-	// Read response
+	// Transmit send buffer, read and validate response
 	recvBuffer := make([]byte, 8)
-	n, err = in.Read(recvBuffer)
-	if err != nil {
-		return stream, err
-	} else if n != len(recvBuffer) {
-		// fmt.Printf("Recv buffer: %v\n", recvBuffer)
-		return stream, fmt.Errorf("Full response was not recieved from device: %d != %d", n, len(recvBuffer))
-	}
-
-	checksumTotal, err := extendedChecksum16(recvBuffer)
-	if err != nil {
-		return stream, err
-	} else if byte((checksumTotal/256)&0xFF) != recvBuffer[5] {
-		return stream, ErrInvalidChecksumResponse
-	} else if byte(checksumTotal&0xFF) != recvBuffer[4] {
-		return stream, ErrInvalidChecksumResponse
-	} else if recvBuffer[1] != 0xF8 || recvBuffer[3] != 0x11 {
-		return stream, ErrInvalidResponseHeader
-	} else if recvBuffer[7] != 0x00 {
-		return stream, ErrInvalidResponseHeader
-	}
-
-	c8, err := extendedChecksum8(recvBuffer)
-	if err != nil {
-		return stream, err
-	} else if c8 != recvBuffer[0] {
-		return stream, ErrInvalidResponseHeader
-	}
-	// fmt.Println("Recv Buffer: ", recvBuffer)
-
-	errCode := recvBuffer[6]
-	if errCode != 0 {
-		return stream, fmt.Errorf("Feedback response error code (%d)", errCode)
-	}
-	return stream, nil
+	return u.command(ctx, header, recvBuffer, func(n int) error {
+		_, err := parseExtended(recvBuffer, n, 0x11)
+		return err
+	})
 }
@@ -2,15 +2,20 @@ package u6_test
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/eliquious/labjack/u6"
 	"github.com/google/gousb"
+	"io"
 	"log"
+	"math"
+	"sync"
 	"testing"
 	"time"
 )
 
-func Example_Open() {
+func ExampleOpenUSBConnection() {
 	// Initialize a new Context.
 	ctx := gousb.NewContext()
 	defer ctx.Close()
@@ -26,32 +31,94 @@ func Example_Open() {
 	fmt.Println(dev.DeviceDesc())
 }
 
-func Test_AIN24(t *testing.T) {
-	// Initialize a new Context.
-	ctx := gousb.NewContext()
-	defer ctx.Close()
-
-	// Open U6 connection
-	dev, err := u6.OpenUSBConnection(ctx)
+func openSimulator(t testing.TB) (*u6.Simulator, *u6.U6) {
+	sim := u6.NewSimulator()
+	dev, err := u6.Open(sim)
 	if err != nil {
-		log.Fatal(err)
+		t.Fatal(err)
 	}
+	return sim, dev
+}
+
+func Test_DeviceDesc(t *testing.T) {
+	sim, dev := openSimulator(t)
 	defer dev.Close()
 
-	// log.Println(dev.DeviceDesc())
-	fmt.Println(dev.DeviceDesc())
+	desc := dev.DeviceDesc()
+	if desc.SerialNumber != sim.SerialNumber {
+		t.Fatalf("Serial number does not match: %d != %d", desc.SerialNumber, sim.SerialNumber)
+	} else if desc.LocalID != sim.LocalID {
+		t.Fatalf("LocalID does not match: %d != %d", desc.LocalID, sim.LocalID)
+	} else if desc.DeviceType != u6.U6Device {
+		t.Fatalf("Device type does not match: %s != %s", desc.DeviceType, u6.U6Device)
+	}
+	t.Log(desc)
+}
+
+func Test_CalibrationInfo(t *testing.T) {
+	sim, dev := openSimulator(t)
+	defer dev.Close()
+
+	cal := dev.GetCalibrationInfo()
+	for i, c := range cal.CalConstants {
+		if math.Abs(c-sim.Calibration.CalConstants[i]) > 1e-9 {
+			t.Fatalf("Calibration constant %d does not match: %v != %v", i, c, sim.Calibration.CalConstants[i])
+		}
+	}
+}
+
+func Test_AIN24(t *testing.T) {
+	sim, dev := openSimulator(t)
+	defer dev.Close()
+	sim.SetAIN(0, 1.25)
 
 	ain := &u6.FeedbackAIN24{PositiveChannel: 0, ResolutionIndex: 8, GainIndex: 0, SettlingFactor: 0, Differential: false}
-	err = dev.Feedback(ain)
+	err := dev.Feedback(ain)
 	if err != nil {
-		log.Fatal(err)
+		t.Fatal(err)
 	}
 
 	voltage, err := ain.GetVoltage()
 	if err != nil {
-		log.Fatal(err)
+		t.Fatal(err)
+	} else if math.Abs(voltage-1.25) > 1e-3 {
+		t.Fatalf("Invalid voltage: %0.6f != 1.25", voltage)
+	}
+	t.Logf("AIN0: %0.6f\n", voltage)
+}
+
+func Test_AIN24AR(t *testing.T) {
+	sim, dev := openSimulator(t)
+	defer dev.Close()
+	sim.SetAIN(0, 0.05)
+	sim.SetAIN(1, 7.5)
+
+	small := &u6.FeedbackAIN24AR{PositiveChannel: 0, ResolutionIndex: 8, GainIndex: u6.AutoRangeGainIndex}
+	large := &u6.FeedbackAIN24AR{PositiveChannel: 1, ResolutionIndex: 8, GainIndex: u6.AutoRangeGainIndex}
+	fixed := &u6.FeedbackAIN24AR{PositiveChannel: 0, ResolutionIndex: 8, GainIndex: 1}
+	if err := dev.Feedback(small, large, fixed); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ain       *u6.FeedbackAIN24AR
+		gainIndex int
+		volts     float64
+	}{
+		{small, 2, 0.05},
+		{large, 0, 7.5},
+		{fixed, 1, 0.05},
+	}
+	for i, test := range tests {
+		voltage, err := test.ain.GetVoltage()
+		if err != nil {
+			t.Fatal(err)
+		} else if test.ain.GetGainIndex() != test.gainIndex || test.ain.GetResolutionIndex() != 8 {
+			t.Fatalf("Invalid gain or resolution of reading %d: %d, %d", i, test.ain.GetGainIndex(), test.ain.GetResolutionIndex())
+		} else if math.Abs(voltage-test.volts) > 1e-3*test.volts {
+			t.Fatalf("Invalid voltage of reading %d: %0.6f != %v", i, voltage, test.volts)
+		}
 	}
-	fmt.Printf("AIN0: %0.6f\n", voltage)
 }
 
 func Test_AIN24Command(t *testing.T) {
@@ -63,19 +130,10 @@ func Test_AIN24Command(t *testing.T) {
 }
 
 func Test_BitStateRead(t *testing.T) {
-	// Initialize a new Context.
-	ctx := gousb.NewContext()
-	defer ctx.Close()
-
-	// Open U6 connection
-	dev, err := u6.OpenUSBConnection(ctx)
-	if err != nil {
-		log.Fatal(err)
-	}
+	sim, dev := openSimulator(t)
 	defer dev.Close()
-
-	// log.Println(dev.DeviceDesc())
-	fmt.Println(dev.DeviceDesc())
+	sim.SetDigital(u6.FIO1, true)
+	sim.SetDigital(u6.FIO4, true)
 
 	fio0 := &u6.FeedbackBitStateRead{BitNumber: u6.FIO0}
 	fio1 := &u6.FeedbackBitStateRead{BitNumber: u6.FIO1}
@@ -84,87 +142,559 @@ func Test_BitStateRead(t *testing.T) {
 	fio4 := &u6.FeedbackBitStateRead{BitNumber: u6.FIO4}
 	fio6 := &u6.FeedbackBitStateRead{BitNumber: u6.FIO6}
 	fio7 := &u6.FeedbackBitStateRead{BitNumber: u6.FIO7}
-	err = dev.Feedback(fio0, fio1, fio2, fio3, fio4, fio6, fio7)
+	err := dev.Feedback(fio0, fio1, fio2, fio3, fio4, fio6, fio7)
 	if err != nil {
-		log.Fatal(err)
+		t.Fatal(err)
 	}
 
-	fmt.Printf("FIO0: %v\n", fio0.GetState())
-	fmt.Printf("FIO1: %v\n", fio1.GetState())
-	fmt.Printf("FIO2: %v\n", fio2.GetState())
-	fmt.Printf("FIO3: %v\n", fio3.GetState())
-	fmt.Printf("FIO4: %v\n", fio4.GetState())
-	fmt.Printf("FIO6: %v\n", fio6.GetState())
-	fmt.Printf("FIO7: %v\n", fio7.GetState())
+	if fio0.GetState() || !fio1.GetState() || fio2.GetState() || fio3.GetState() ||
+		!fio4.GetState() || fio6.GetState() || fio7.GetState() {
+		t.Fatalf("Invalid states: FIO0=%v FIO1=%v FIO2=%v FIO3=%v FIO4=%v FIO6=%v FIO7=%v",
+			fio0.GetState(), fio1.GetState(), fio2.GetState(), fio3.GetState(), fio4.GetState(), fio6.GetState(), fio7.GetState())
+	}
 }
 
-func Test_StreamConfig(t *testing.T) {
-
-	// Initialize a new Context.
-	ctx := gousb.NewContext()
-	defer ctx.Close()
+func Test_BitWrite(t *testing.T) {
+	sim, dev := openSimulator(t)
+	defer dev.Close()
 
-	// Open U6 connection
-	dev, err := u6.OpenUSBConnection(ctx)
+	err := dev.Feedback(
+		&u6.FeedbackBitDirWrite{BitNumber: u6.EIO2, Direction: u6.BitDirectionWrite},
+		&u6.FeedbackBitStateWrite{BitNumber: u6.EIO2, State: u6.BitStateEnabled},
+	)
 	if err != nil {
-		log.Fatal(err)
+		t.Fatal(err)
 	}
-	defer dev.Close()
 
-	fmt.Println(dev.DeviceDesc())
+	dir, state := sim.Digital(u6.EIO2)
+	if dir != u6.BitDirectionWrite || !state {
+		t.Fatalf("Invalid EIO2: direction=%d state=%v", dir, state)
+	}
+}
+
+func Test_StreamConfig(t *testing.T) {
+	_, dev := openSimulator(t)
+	defer dev.Close()
 
-	_, err = dev.NewStream(&u6.StreamConfig{1, 25, 0, 1000, &u6.ScanConfig{u6.ClockSpeed4Mhz, u6.ClockDivisionOff, 0}, []u6.ChannelConfig{{1, u6.GainIndex1, u6.DifferentialInputDisabled}}})
+	_, err := dev.NewStream(&u6.StreamConfig{1, 25, 0, 1000, &u6.ScanConfig{u6.ClockSpeed4Mhz, u6.ClockDivisionOff, 0}, []u6.ChannelConfig{{1, u6.GainIndex1, u6.DifferentialInputDisabled}}})
 	if err != nil {
-		log.Fatal(err)
+		t.Fatal(err)
 	}
 }
 
-func Test_StreamData(t *testing.T) {
+func Test_SimulatorStreamShortBuffer(t *testing.T) {
+	sim, dev := openSimulator(t)
+	defer dev.Close()
 
-	// Initialize a new Context.
-	ctx := gousb.NewContext()
-	defer ctx.Close()
-	ctx.Debug(1)
+	_, err := dev.NewStream(&u6.StreamConfig{1, 25, 0, 1000, &u6.ScanConfig{u6.ClockSpeed4Mhz, u6.ClockDivisionOff, 0}, []u6.ChannelConfig{{1, u6.GainIndex1, u6.DifferentialInputDisabled}}})
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	// Open U6 connection
-	dev, err := u6.OpenUSBConnection(ctx)
+	// StreamStart
+	ctx := context.Background()
+	if _, err := sim.Write(ctx, []byte{0xA8, 0xA8}); err != nil {
+		t.Fatal(err)
+	} else if _, err := sim.Read(ctx, make([]byte, 4)); err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err := sim.OpenStream(64)
 	if err != nil {
-		log.Fatal(err)
+		t.Fatal(err)
 	}
-	defer dev.Close()
+	defer stream.Close()
 
-	fmt.Println(dev.DeviceDesc())
+	if n, err := stream.Read(ctx, make([]byte, 63)); n != 0 || err != io.ErrShortBuffer {
+		t.Fatalf("Expected io.ErrShortBuffer; got %d, %v", n, err)
+	}
+	if n, err := stream.Read(ctx, make([]byte, 100)); n != 64 || err != nil {
+		t.Fatalf("Expected one packet; got %d, %v", n, err)
+	}
+}
 
-	stream, err := dev.NewStream(&u6.StreamConfig{1, 25, 0, 1000, &u6.ScanConfig{u6.ClockSpeed4Mhz, u6.ClockDivisionOff, 0}, []u6.ChannelConfig{{12, u6.GainIndex10, u6.DifferentialInputDisabled}}})
+func Test_StreamData(t *testing.T) {
+	sim, dev := openSimulator(t)
+	defer dev.Close()
+	sim.SetAIN(12, 0.5)
+	sim.SetAIN(13, -0.25)
+
+	stream, err := dev.NewStream(&u6.StreamConfig{1, 25, 0, 1000, &u6.ScanConfig{u6.ClockSpeed4Mhz, u6.ClockDivisionOff, 0}, []u6.ChannelConfig{
+		{12, u6.GainIndex10, u6.DifferentialInputDisabled},
+		{13, u6.GainIndex10, u6.DifferentialInputDisabled},
+	}})
 	if err != nil {
-		log.Fatal(err)
+		t.Fatal(err)
 	}
 
 	ch, err := stream.Start()
 	if err != nil {
-		log.Fatal(err)
+		t.Fatal(err)
 	}
+	defer stream.Stop()
 
+	expected := []float64{0.5, -0.25}
 	timeout := time.After(time.Second * 10)
-OUTER:
-	for {
+	for packets := 0; packets < 20; packets++ {
 		select {
 		case resp := <-ch:
-			fmt.Println("Packet: ", resp.PacketNumber)
+			if resp.Error != nil {
+				t.Fatal(resp.Error)
+			}
 			for _, channel := range resp.Data {
 				voltage, err := channel.GetCalibratedAIN()
 				if err != nil {
-					fmt.Println(err)
-					continue
+					t.Fatal(err)
+				} else if math.Abs(voltage-expected[channel.ChannelIndex]) > 1e-4 {
+					t.Fatalf("Invalid voltage: ChannelIndex=%d; ScanNumber=%d; Voltage=%0.6f", channel.ChannelIndex, channel.ScanNumber, voltage)
 				}
-				fmt.Printf("\tChannelIndex=%d;\n\tScanNumber=%d;\n\tVoltage=%0.6f\n", channel.ChannelIndex, channel.ScanNumber, voltage)
 			}
-
-			// fmt.Println(time.Now(), voltage)
 		case <-timeout:
-			stream.Stop()
-			ch = nil
-			break OUTER
+			t.Fatal("Timed out waiting for stream data")
+		}
+	}
+}
+
+func Test_ConcurrentFeedback(t *testing.T) {
+	sim, dev := openSimulator(t)
+	defer dev.Close()
+	for i := 0; i < 4; i++ {
+		sim.SetAIN(i, float64(i))
+	}
+
+	// Stream while issuing Feedback commands
+	sim.SetAIN(12, 0.5)
+	stream, err := dev.NewStream(&u6.StreamConfig{1, 25, 0, 1000, &u6.ScanConfig{u6.ClockSpeed4Mhz, u6.ClockDivisionOff, 0}, []u6.ChannelConfig{{12, u6.GainIndex10, u6.DifferentialInputDisabled}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch, err := stream.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Stop()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(channel int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				ain := &u6.FeedbackAIN24{PositiveChannel: channel, ResolutionIndex: 8}
+				if err := dev.Feedback(ain); err != nil {
+					errs <- err
+					return
+				}
+				voltage, _ := ain.GetVoltage()
+				if math.Abs(voltage-float64(channel)) > 1e-3 {
+					errs <- fmt.Errorf("AIN%d: %0.6f != %d", channel, voltage, channel)
+					return
+				}
+			}
+		}(i)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	for {
+		select {
+		case resp := <-ch:
+			if resp.Error != nil {
+				t.Fatal(resp.Error)
+			}
+		case err := <-errs:
+			t.Fatal(err)
+		case <-done:
+			return
+		}
+	}
+}
+
+func Test_GettersDuringFeedback(t *testing.T) {
+	sim, dev := openSimulator(t)
+	defer dev.Close()
+
+	// The state getters do not wait for a command in flight
+	sim.ResponseDelay = 200 * time.Millisecond
+	done := make(chan error, 1)
+	go func() {
+		done <- dev.Feedback(&u6.FeedbackBitStateRead{BitNumber: u6.FIO0})
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	start := time.Now()
+	dev.DeviceDesc()
+	dev.GetCalibrationInfo()
+	dev.RetryPolicy()
+	dev.Stats()
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("Getters blocked for %v", elapsed)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_FeedbackContext(t *testing.T) {
+	sim, dev := openSimulator(t)
+	defer dev.Close()
+	sim.SetAIN(0, 1.5)
+
+	// The response is abandoned when the deadline passes
+	sim.ResponseDelay = 50 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	ain := &u6.FeedbackAIN24{PositiveChannel: 0, ResolutionIndex: 8}
+	err := dev.FeedbackContext(ctx, ain)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected context.DeadlineExceeded; got %v", err)
+	}
+
+	// The abandoned response must not be taken for the next one
+	sim.ResponseDelay = 0
+	if err = dev.Feedback(ain); err != nil {
+		t.Fatal(err)
+	}
+	voltage, _ := ain.GetVoltage()
+	if math.Abs(voltage-1.5) > 1e-3 {
+		t.Fatalf("Invalid voltage: %0.6f != 1.5", voltage)
+	}
+}
+
+func Test_FeedbackSplit(t *testing.T) {
+	sim, dev := openSimulator(t)
+	defer dev.Close()
+
+	// 16 AIN24 commands exceed the 64 byte command frame
+	var cmds []u6.FeedbackCommand
+	var ains []*u6.FeedbackAIN24
+	for i := 0; i < 16; i++ {
+		sim.SetAIN(i%14, float64(i%14)/2)
+		ain := &u6.FeedbackAIN24{PositiveChannel: i % 14, ResolutionIndex: 8}
+		ains = append(ains, ain)
+		cmds = append(cmds, ain)
+	}
+	cmds = append(cmds, &u6.FeedbackBitStateWrite{BitNumber: u6.FIO5, State: u6.BitStateEnabled})
+
+	before := dev.Stats().Commands["Feedback"].Count
+	if err := dev.Feedback(cmds...); err != nil {
+		t.Fatal(err)
+	} else if count := dev.Stats().Commands["Feedback"].Count - before; count != 2 {
+		t.Fatalf("Expected 2 packets; got %d", count)
+	}
+
+	for i, ain := range ains {
+		voltage, err := ain.GetVoltage()
+		if err != nil {
+			t.Fatal(err)
+		} else if math.Abs(voltage-float64(i%14)/2) > 1e-3 {
+			t.Fatalf("Invalid voltage of command %d: %0.6f", i, voltage)
 		}
 	}
+	if _, state := sim.Digital(u6.FIO5); !state {
+		t.Fatal("FIO5 was not written")
+	}
+
+	// The failed command is reported by its position in the Feedback call
+	err := dev.Feedback(append(cmds[:16:16], invalidIOType{})...)
+	var ferr *u6.FeedbackError
+	if !errors.As(err, &ferr) {
+		t.Fatalf("Expected FeedbackError; got %v", err)
+	} else if ferr.Index != 16 || len(ferr.Executed) != 16 || len(ferr.Populated) != 16 {
+		t.Fatalf("Invalid FeedbackError: index=%d; executed=%d; populated=%d", ferr.Index, len(ferr.Executed), len(ferr.Populated))
+	}
+}
+
+func Test_OpenContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := u6.OpenContext(ctx, u6.NewSimulator())
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled; got %v", err)
+	}
+}
+
+func Test_RetryPolicy(t *testing.T) {
+	sim, dev := openSimulator(t)
+	defer dev.Close()
+
+	// Corrupted responses are retried
+	ain := &u6.FeedbackAIN24{PositiveChannel: 0, ResolutionIndex: 8}
+	sim.CorruptResponses(2)
+	if err := dev.Feedback(ain); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without retries the corruption is returned
+	policy := dev.RetryPolicy()
+	policy.MaxRetries = 0
+	dev.SetRetryPolicy(policy)
+	sim.CorruptResponses(1)
+	if err := dev.Feedback(ain); !u6.IsRetryable(err) {
+		t.Fatalf("Expected retryable error; got %v", err)
+	}
+
+	// Read timeouts
+	policy.MaxRetries = 1
+	policy.ReadTimeout = 10 * time.Millisecond
+	dev.SetRetryPolicy(policy)
+	sim.ResponseDelay = 50 * time.Millisecond
+	if err := dev.Feedback(ain); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected context.DeadlineExceeded; got %v", err)
+	}
+
+	sim.ResponseDelay = 0
+	if err := dev.Feedback(ain); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_RetryOutputs(t *testing.T) {
+	sim, dev := openSimulator(t)
+	defer dev.Close()
+
+	// A corrupted response is returned after the output was written, so the
+	// command is not repeated
+	sim.CorruptResponses(1)
+	err := dev.Feedback(&u6.FeedbackBitStateWrite{BitNumber: u6.FIO1, State: u6.BitStateEnabled})
+	if !errors.Is(err, u6.ErrInvalidChecksum) {
+		t.Fatalf("Expected ErrInvalidChecksum; got %v", err)
+	} else if stats := dev.Stats(); stats.Retries != 0 {
+		t.Fatalf("Output command was retried %d times", stats.Retries)
+	} else if _, on := sim.Digital(u6.FIO1); !on {
+		t.Fatal("FIO1 was not written")
+	}
+
+	if !u6.IsRetryableOutput(u6.ErrInvalidChecksumResponse) || u6.IsRetryableOutput(context.DeadlineExceeded) {
+		t.Fatal("Invalid IsRetryableOutput")
+	}
+}
+
+func Test_Temperature(t *testing.T) {
+
+	// AIN14 reads 0x994E: (0x994E - 33523) * 0.00031580578 = 1.807356 V, so
+	// 1.807356 * -92.379 + 465.129 = 298.167 K = 25.017 C.
+	temp := &u6.FeedbackTemperature{ResolutionIndex: 8}
+	temp.SetCalibrationInfo(u6.DefaultCalibrationInfo)
+	if _, err := temp.ReadFrom(bytes.NewReader([]byte{0x00, 0x4E, 0x99})); err != nil {
+		t.Fatal(err)
+	}
+	if kelvin, err := temp.GetKelvin(); err != nil {
+		t.Fatal(err)
+	} else if math.Abs(kelvin-298.167) > 0.001 {
+		t.Fatalf("Invalid temperature: %0.3f K", kelvin)
+	}
+	if celsius, err := temp.GetCelsius(); err != nil {
+		t.Fatal(err)
+	} else if math.Abs(celsius-25.017) > 0.001 {
+		t.Fatalf("Invalid temperature: %0.3f C", celsius)
+	}
+
+	// Read from the device, batched with another reading
+	sim, dev := openSimulator(t)
+	defer dev.Close()
+	sim.SetTemperature(298.15)
+
+	if kelvin, err := dev.ReadTemperature(); err != nil {
+		t.Fatal(err)
+	} else if math.Abs(kelvin-298.15) > 0.05 {
+		t.Fatalf("Invalid temperature: %0.3f K", kelvin)
+	}
+
+	temp = &u6.FeedbackTemperature{ResolutionIndex: 8}
+	if err := dev.Feedback(&u6.FeedbackAIN24{PositiveChannel: 0, ResolutionIndex: 8}, temp); err != nil {
+		t.Fatal(err)
+	} else if _, err := temp.GetCelsius(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_DAC(t *testing.T) {
+	sim, dev := openSimulator(t)
+	defer dev.Close()
+
+	if err := dev.SetDACVoltage(0, 1.5); err != nil {
+		t.Fatal(err)
+	} else if volts := sim.DAC(0); math.Abs(volts-1.5) > 0.001 {
+		t.Fatalf("Invalid DAC0 voltage: %v", volts)
+	}
+
+	// Out of range voltages are clamped
+	if err := dev.SetDACVoltage(1, -1); err != u6.ErrDACClipped {
+		t.Fatalf("Expected ErrDACClipped; got %v", err)
+	} else if volts := sim.DAC(1); volts != 0 {
+		t.Fatalf("Invalid DAC1 voltage: %v", volts)
+	}
+	if err := dev.SetDACVoltage(1, 6); err != u6.ErrDACClipped {
+		t.Fatalf("Expected ErrDACClipped; got %v", err)
+	} else if volts := sim.DAC(1); volts < 4.9 || volts > u6.MaxDACVoltage {
+		t.Fatalf("Invalid DAC1 voltage: %v", volts)
+	}
+
+	cal := u6.DefaultCalibrationInfo
+	cal.CalConstants[18] = 13000
+	cal.CalConstants[19] = 100
+	if counts, clipped, err := u6.DACCounts(cal, 1, 2); err != nil || counts != 26100 || clipped {
+		t.Fatalf("Invalid DAC1 counts: %d, %v, %v", counts, clipped, err)
+	} else if _, _, err := u6.DACCounts(cal, 2, 2); err == nil {
+		t.Fatal("Expected error for DAC2")
+	} else if _, _, err := u6.DACCounts(cal, -1, 2); err == nil {
+		t.Fatal("Expected error for DAC-1")
+	}
+}
+
+func Test_PortState(t *testing.T) {
+	sim, dev := openSimulator(t)
+	defer dev.Close()
+	sim.SetDigital(u6.FIO1, true)
+	sim.SetDigital(u6.EIO7, true)
+	sim.SetDigital(u6.CIO2, true)
+
+	write := &u6.FeedbackPortStateWrite{}
+	for _, line := range []struct {
+		bit   u6.DigitalIOBit
+		state bool
+	}{{u6.FIO1, false}, {u6.EIO0, true}, {u6.CIO3, true}} {
+		if err := write.Set(line.bit, line.state); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := write.Set(u6.DigitalIOBit(24), true); err == nil {
+		t.Fatal("Expected error for invalid line")
+	}
+	err := dev.Feedback(
+		write,
+		&u6.FeedbackPortDirWrite{FIOWriteMask: 0x02, EIOWriteMask: 0x01, FIODirection: 0x02, EIODirection: 0x01},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := &u6.FeedbackPortStateRead{}
+	dir := &u6.FeedbackPortDirRead{}
+	if err := dev.Feedback(state, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// Lines outside of the write mask are unchanged
+	if fio, eio, cio := state.GetPorts(); fio != 0x00 || eio != 0x81 || cio != 0x0C {
+		t.Fatalf("Invalid port states: FIO=%#02x EIO=%#02x CIO=%#02x", fio, eio, cio)
+	} else if !state.GetState(u6.EIO7) || state.GetState(u6.FIO1) || !state.GetState(u6.CIO3) {
+		t.Fatal("Invalid line states")
+	}
+	if fio, eio, cio := dir.GetPorts(); fio != 0x02 || eio != 0x01 || cio != 0x00 {
+		t.Fatalf("Invalid port directions: FIO=%#02x EIO=%#02x CIO=%#02x", fio, eio, cio)
+	} else if dir.GetDirection(u6.FIO1) != u6.BitDirectionWrite || dir.GetDirection(u6.FIO2) != u6.BitDirectionRead {
+		t.Fatal("Invalid line directions")
+	}
+}
+
+func Test_DigitalState(t *testing.T) {
+	sim, dev := openSimulator(t)
+	defer dev.Close()
+	sim.SetDigital(u6.EIO4, true)
+
+	err := dev.Feedback(
+		&u6.FeedbackBitStateWrite{BitNumber: u6.FIO3, State: u6.BitStateEnabled},
+		&u6.FeedbackBitDirWrite{BitNumber: u6.FIO3, Direction: u6.BitDirectionWrite},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fio3 := &u6.FeedbackBitDirRead{BitNumber: u6.FIO3}
+	eio4 := &u6.FeedbackBitDirRead{BitNumber: u6.EIO4}
+	if err := dev.Feedback(fio3, eio4); err != nil {
+		t.Fatal(err)
+	} else if fio3.GetDirection() != u6.BitDirectionWrite || eio4.GetDirection() != u6.BitDirectionRead {
+		t.Fatalf("Invalid directions: FIO3=%d EIO4=%d", fio3.GetDirection(), eio4.GetDirection())
+	}
+
+	lines, err := dev.DigitalState()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(lines) != int(u6.CIO3)+1 {
+		t.Fatalf("Expected %d lines; got %d", u6.CIO3+1, len(lines))
+	}
+	for bit, line := range lines {
+		dir, state := sim.Digital(u6.DigitalIOBit(bit))
+		if line.Direction != dir || line.State != state {
+			t.Fatalf("Invalid %s: %+v", u6.DigitalIOBit(bit), line)
+		}
+	}
+	if line := lines[u6.FIO3]; line.Direction != u6.BitDirectionWrite || !line.State {
+		t.Fatalf("Invalid FIO3: %+v", line)
+	} else if line := lines[u6.EIO4]; line.Direction != u6.BitDirectionRead || !line.State {
+		t.Fatalf("Invalid EIO4: %+v", line)
+	}
+}
+
+func BenchmarkFeedback(b *testing.B) {
+	sim, dev := openSimulator(b)
+	defer dev.Close()
+	sim.SetAIN(0, 1.5)
+
+	ain := &u6.FeedbackAIN24{PositiveChannel: 0, ResolutionIndex: 1}
+	fio := &u6.FeedbackBitStateRead{BitNumber: u6.FIO0}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := dev.Feedback(ain, fio); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// claimCost models claiming the USB interface and opening its endpoints.
+const claimCost = 100 * time.Microsecond
+
+// claimingTransport models the claim cost of a USB transport: once when
+// cached, or for every command as before the claim was held by the U6.
+type claimingTransport struct {
+	*u6.Simulator
+	perCall bool
+}
+
+func (c *claimingTransport) claim() {
+	for start := time.Now(); time.Since(start) < claimCost; {
+	}
+}
+
+func (c *claimingTransport) Write(ctx context.Context, p []byte) (int, error) {
+	if c.perCall {
+		c.claim()
+	}
+	return c.Simulator.Write(ctx, p)
+}
+
+func BenchmarkFeedbackClaim(b *testing.B) {
+	for _, bench := range []struct {
+		name    string
+		perCall bool
+	}{{"PerCall", true}, {"Cached", false}} {
+		b.Run(bench.name, func(b *testing.B) {
+			t := &claimingTransport{Simulator: u6.NewSimulator(), perCall: bench.perCall}
+			t.claim()
+			dev, err := u6.Open(t)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer dev.Close()
+
+			ain := &u6.FeedbackAIN24{PositiveChannel: 0, ResolutionIndex: 1}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := dev.Feedback(ain); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
 }
@@ -0,0 +1,282 @@
+package u6
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/eliquious/labjack"
+	"github.com/google/gousb"
+)
+
+// ListDevices returns the description of every attached U6. The devices are
+// closed again before returning. Devices which cannot be described, such as a
+// U6 in use by another process, are skipped. The descriptions of the other
+// devices are then returned with an error which counts the skipped devices and
+// wraps the first failure.
+func ListDevices(usbctx *gousb.Context) ([]DeviceDesc, error) {
+	if usbctx == nil {
+		return nil, ErrInvalidContext
+	}
+
+	devs, err := openUSBDevices(usbctx, func(*gousb.DeviceDesc) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+
+	var descs []DeviceDesc
+	var errs []error
+	for _, dev := range devs {
+		desc, err := describeUSBDevice(context.Background(), dev)
+		dev.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("U6 at bus %d address %d: %w", dev.Desc.Bus, dev.Desc.Address, err))
+			continue
+		}
+		descs = append(descs, desc)
+	}
+	if len(errs) > 0 {
+		return descs, fmt.Errorf("%d of %d U6 devices could not be described: %w", len(errs), len(devs), errs[0])
+	}
+	return descs, nil
+}
+
+// OpenBySerialNumber opens the U6 with the given serial number.
+func OpenBySerialNumber(usbctx *gousb.Context, serial int, opts ...Option) (*U6, error) {
+	return openUSBMatch(context.Background(), usbctx, func(*gousb.DeviceDesc) bool { return true }, func(desc DeviceDesc) bool {
+		return desc.SerialNumber == serial
+	}, opts)
+}
+
+// OpenByLocalID opens the U6 with the given LocalID.
+func OpenByLocalID(usbctx *gousb.Context, localID int, opts ...Option) (*U6, error) {
+	return openUSBMatch(context.Background(), usbctx, func(*gousb.DeviceDesc) bool { return true }, func(desc DeviceDesc) bool {
+		return desc.LocalID == localID
+	}, opts)
+}
+
+// OpenByAddress opens the U6 at the given USB bus and address.
+func OpenByAddress(usbctx *gousb.Context, bus, address int, opts ...Option) (*U6, error) {
+	return openUSBMatch(context.Background(), usbctx, func(desc *gousb.DeviceDesc) bool {
+		return desc.Bus == bus && desc.Address == address
+	}, func(DeviceDesc) bool { return true }, opts)
+}
+
+// openUSBDevices opens every attached U6 accepted by filter.
+func openUSBDevices(usbctx *gousb.Context, filter func(*gousb.DeviceDesc) bool) ([]*gousb.Device, error) {
+	devs, err := usbctx.OpenDevices(func(desc *gousb.DeviceDesc) bool {
+		return desc.Vendor == labjack.LabJackVendorID && desc.Product == labjack.U6ProductID && filter(desc)
+	})
+
+	// Devices which could be opened are still returned on error.
+	if err != nil && len(devs) == 0 {
+		return nil, ErrLibUSB{"Could not open devices", err}
+	}
+	return devs, nil
+}
+
+// openUSBMatch opens the first U6 accepted by filter and match. All other devices are closed.
+func openUSBMatch(ctx context.Context, usbctx *gousb.Context, filter func(*gousb.DeviceDesc) bool, match func(DeviceDesc) bool, opts []Option) (*U6, error) {
+	dev, err := findUSBDevice(ctx, usbctx, filter, match)
+	if err != nil {
+		return &emptyU6, err
+	}
+	return openUSBDevice(ctx, dev, newOptions(opts))
+}
+
+// findUSBDevice returns the first U6 accepted by filter and match. All other devices are closed.
+func findUSBDevice(ctx context.Context, usbctx *gousb.Context, filter func(*gousb.DeviceDesc) bool, match func(DeviceDesc) bool) (*gousb.Device, error) {
+	if usbctx == nil {
+		return nil, ErrInvalidContext
+	}
+
+	devs, err := openUSBDevices(usbctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var selected *gousb.Device
+	for _, dev := range devs {
+		if selected != nil {
+			dev.Close()
+			continue
+		}
+
+		desc, err := describeUSBDevice(ctx, dev)
+		if err == nil && match(desc) {
+			selected = dev
+			continue
+		}
+		dev.Close()
+	}
+
+	if selected == nil {
+		return nil, ErrDeviceNotFound
+	}
+	return selected, nil
+}
+
+// USBReopener returns a ReconnectConfig.Reopen function which reopens the U6
+// with the given serial number once it is attached again.
+func USBReopener(usbctx *gousb.Context, serial int) func(context.Context) (Transport, error) {
+	return func(ctx context.Context) (Transport, error) {
+		dev, err := findUSBDevice(ctx, usbctx, func(*gousb.DeviceDesc) bool { return true }, func(desc DeviceDesc) bool {
+			return desc.SerialNumber == serial
+		})
+		if err != nil {
+			return nil, err
+		}
+		return openUSBTransport(dev, true)
+	}
+}
+
+// describeUSBDevice reads the configuration of a U6 without reading the calibration.
+func describeUSBDevice(ctx context.Context, dev *gousb.Device) (DeviceDesc, error) {
+	if err := dev.SetAutoDetach(true); err != nil {
+		return DeviceDesc{}, err
+	}
+
+	t, err := newUSBTransport(dev)
+	if err != nil {
+		return DeviceDesc{}, err
+	}
+	defer t.done()
+
+	u := &U6{transport: t, policy: DefaultRetryPolicy}
+	if err := u.initConnection(ctx); err != nil {
+		return DeviceDesc{}, err
+	}
+	u.config.Bus = dev.Desc.Bus
+	u.config.Address = dev.Desc.Address
+	return u.config, nil
+}
+
+// openUSBDevice resets the device, unless disabled by the options, and
+// initializes the U6.
+func openUSBDevice(ctx context.Context, dev *gousb.Device, o options) (*U6, error) {
+	t, err := openUSBTransport(dev, !o.skipReset)
+	if err != nil {
+		return &emptyU6, err
+	}
+
+	u, err := openContext(ctx, t, o)
+	if err != nil {
+		t.Close()
+		return u, err
+	}
+	u.config.Bus, u.config.Address = t.location()
+	return u, nil
+}
+
+// openUSBTransport optionally resets the device and claims its interface. The
+// device is closed on error.
+func openUSBTransport(dev *gousb.Device, reset bool) (*usbTransport, error) {
+	if reset {
+		if err := dev.Reset(); err != nil {
+			dev.Close()
+			return nil, err
+		}
+	}
+	if err := dev.SetAutoDetach(true); err != nil {
+		dev.Close()
+		return nil, err
+	}
+
+	t, err := newUSBTransport(dev)
+	if err != nil {
+		dev.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// usbTransport is the gousb backed Transport. The interface is claimed and the
+// endpoints are opened once for the lifetime of the transport.
+type usbTransport struct {
+	device *gousb.Device
+	done   func()
+	out    *gousb.OutEndpoint
+	in     *gousb.InEndpoint
+	stream *gousb.InEndpoint
+}
+
+func newUSBTransport(dev *gousb.Device) (*usbTransport, error) {
+
+	// Claim USB interface
+	inf, done, err := dev.DefaultInterface()
+	if err != nil {
+		return nil, err
+	}
+
+	// Open endpoints
+	out, err := inf.OutEndpoint(labjack.U6PipeOutEP1)
+	if err != nil {
+		done()
+		return nil, err
+	}
+	in, err := inf.InEndpoint(labjack.U6PipeInEP2)
+	if err != nil {
+		done()
+		return nil, err
+	}
+	stream, err := inf.InEndpoint(labjack.U6PipeInEP3)
+	if err != nil {
+		done()
+		return nil, err
+	}
+	return &usbTransport{dev, done, out, in, stream}, nil
+}
+
+// location returns the USB bus and address of the device.
+func (t *usbTransport) location() (int, int) {
+	return t.device.Desc.Bus, t.device.Desc.Address
+}
+
+// Write sends the command on EP1.
+func (t *usbTransport) Write(ctx context.Context, p []byte) (int, error) {
+	n, err := t.out.WriteContext(ctx, p)
+	return n, usbError(err)
+}
+
+// Read reads the response from EP2.
+func (t *usbTransport) Read(ctx context.Context, p []byte) (int, error) {
+	n, err := t.in.ReadContext(ctx, p)
+	return n, usbError(err)
+}
+
+// OpenStream opens a read stream on EP3.
+func (t *usbTransport) OpenStream(transferSize int) (StreamReader, error) {
+	stream, err := t.stream.NewStream(transferSize, 20)
+	if err != nil {
+		return nil, err
+	}
+	return usbStream{stream}, nil
+}
+
+// Close releases the interface and closes the device.
+func (t *usbTransport) Close() error {
+	t.done()
+	return t.device.Close()
+}
+
+// usbStream reads from a gousb read stream.
+type usbStream struct {
+	stream *gousb.ReadStream
+}
+
+func (s usbStream) Read(ctx context.Context, p []byte) (int, error) {
+	n, err := s.stream.ReadContext(ctx, p)
+	return n, usbError(err)
+}
+
+func (s usbStream) Close() error {
+	return s.stream.Close()
+}
+
+// usbError maps the errors of a removed device to ErrDeviceDisconnected.
+func usbError(err error) error {
+	if errors.Is(err, gousb.ErrorNoDevice) || errors.Is(err, gousb.TransferNoDevice) {
+		return fmt.Errorf("%w: %v", ErrDeviceDisconnected, err)
+	}
+	return err
+}
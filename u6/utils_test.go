@@ -89,3 +89,16 @@ func TestUint8ArrayToFloat64(t *testing.T) {
 	}
 	t.Logf("Equal: %v == %v", uint8ArrayToFloat64(data, 0), -0.10599447833374143)
 }
+
+func TestSetChecksum8Carry(t *testing.T) {
+	// Bytes 1-5 sum to 511 which carries twice when folded.
+	command := []byte{0, 249, 29, 192, 2, 39, 0, 0}
+	setChecksum8(command, 6)
+
+	c, err := extendedChecksum8(command)
+	if err != nil {
+		t.Fatalf("Checksum error")
+	} else if command[0] != c || c != 1 {
+		t.Fatalf("Checksums do not match: %d != %d", command[0], c)
+	}
+}
@@ -0,0 +1,202 @@
+package labjack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/gousb"
+)
+
+// ErrInvalidContext is returned if the USB context is nil.
+var ErrInvalidContext = errors.New("Invalid USB context")
+
+// DeviceEventType describes whether a device was attached or detached.
+type DeviceEventType int
+
+const (
+
+	// DeviceAttached is reported when a LabJack is connected.
+	DeviceAttached DeviceEventType = iota
+
+	// DeviceDetached is reported when a LabJack is disconnected.
+	DeviceDetached
+)
+
+func (t DeviceEventType) String() string {
+	switch t {
+	case DeviceAttached:
+		return "Attached"
+	case DeviceDetached:
+		return "Detached"
+	}
+	return fmt.Sprintf("DeviceEventType(%d)", int(t))
+}
+
+// DeviceEvent reports a LabJack attached to or detached from the USB bus.
+type DeviceEvent struct {
+	Type    DeviceEventType
+	Time    time.Time
+	Vendor  gousb.ID
+	Product gousb.ID
+	Bus     int
+	Address int
+
+	// SerialNumber is the USB serial number string of the device. It is empty
+	// if the device could not be opened to read it.
+	SerialNumber string
+}
+
+// DefaultWatchInterval is the polling interval of Watch if none is given.
+const DefaultWatchInterval = time.Second
+
+// Watch reports LabJack devices attached to and detached from the USB bus
+// until the context is done, then closes the channel. The bus is polled at
+// the given interval. Devices already attached are reported first.
+//
+// Attached U6 devices may be opened with u6.OpenByAddress(usbctx, event.Bus, event.Address)
+// when event.Product is U6ProductID.
+func Watch(ctx context.Context, usbctx *gousb.Context, interval time.Duration) (<-chan DeviceEvent, error) {
+	if usbctx == nil {
+		return nil, ErrInvalidContext
+	}
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+
+	events := make(chan DeviceEvent, 16)
+	scan := func() (map[usbLocation]gousb.DeviceDesc, error) {
+		return scanDevices(usbctx)
+	}
+	serial := func(loc usbLocation) string {
+		return readSerialNumber(usbctx, loc)
+	}
+	go watch(ctx, interval, scan, serial, events)
+	return events, nil
+}
+
+// usbLocation identifies an attached device.
+type usbLocation struct {
+	bus     int
+	address int
+}
+
+// watch polls scan until the context is done and reports the changes. serial
+// reads the serial number of an attached device.
+func watch(ctx context.Context, interval time.Duration, scan func() (map[usbLocation]gousb.DeviceDesc, error),
+	serial func(usbLocation) string, events chan DeviceEvent) {
+	defer close(events)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	attached := make(map[usbLocation]DeviceEvent)
+	for {
+		if present, err := scan(); err == nil {
+			detached, added := diffDevices(attached, present)
+			for _, event := range detached {
+				delete(attached, usbLocation{event.Bus, event.Address})
+				event.Time = time.Now()
+				if !sendEvent(ctx, events, event) {
+					return
+				}
+			}
+
+			for _, desc := range added {
+				loc := usbLocation{desc.Bus, desc.Address}
+				event := DeviceEvent{
+					Type:         DeviceAttached,
+					Time:         time.Now(),
+					Vendor:       desc.Vendor,
+					Product:      desc.Product,
+					Bus:          desc.Bus,
+					Address:      desc.Address,
+					SerialNumber: serial(loc),
+				}
+				attached[loc] = event
+				if !sendEvent(ctx, events, event) {
+					return
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// diffDevices compares the attached devices with the present ones. It returns
+// the detach events of the devices which are gone and the devices which were
+// attached since, both ordered by bus and address.
+func diffDevices(attached map[usbLocation]DeviceEvent, present map[usbLocation]gousb.DeviceDesc) ([]DeviceEvent, []gousb.DeviceDesc) {
+	var detached []DeviceEvent
+	for loc, event := range attached {
+		if _, ok := present[loc]; !ok {
+			event.Type = DeviceDetached
+			detached = append(detached, event)
+		}
+	}
+	sort.Slice(detached, func(i, j int) bool {
+		return locationLess(usbLocation{detached[i].Bus, detached[i].Address}, usbLocation{detached[j].Bus, detached[j].Address})
+	})
+
+	var added []gousb.DeviceDesc
+	for loc, desc := range present {
+		if _, ok := attached[loc]; !ok {
+			added = append(added, desc)
+		}
+	}
+	sort.Slice(added, func(i, j int) bool {
+		return locationLess(usbLocation{added[i].Bus, added[i].Address}, usbLocation{added[j].Bus, added[j].Address})
+	})
+	return detached, added
+}
+
+func locationLess(a, b usbLocation) bool {
+	if a.bus != b.bus {
+		return a.bus < b.bus
+	}
+	return a.address < b.address
+}
+
+func sendEvent(ctx context.Context, events chan DeviceEvent, event DeviceEvent) bool {
+	select {
+	case events <- event:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// scanDevices lists the attached LabJack devices without opening them.
+func scanDevices(usbctx *gousb.Context) (map[usbLocation]gousb.DeviceDesc, error) {
+	present := make(map[usbLocation]gousb.DeviceDesc)
+	_, err := usbctx.OpenDevices(func(desc *gousb.DeviceDesc) bool {
+		if desc.Vendor == LabJackVendorID {
+			present[usbLocation{desc.Bus, desc.Address}] = *desc
+		}
+		return false
+	})
+	return present, err
+}
+
+// readSerialNumber opens the device at loc to read its serial number string.
+func readSerialNumber(usbctx *gousb.Context, loc usbLocation) string {
+	devs, _ := usbctx.OpenDevices(func(desc *gousb.DeviceDesc) bool {
+		return desc.Vendor == LabJackVendorID && desc.Bus == loc.bus && desc.Address == loc.address
+	})
+
+	var serial string
+	for _, dev := range devs {
+		if s, err := dev.SerialNumber(); err == nil {
+			serial = s
+		}
+		dev.Close()
+	}
+	return serial
+}
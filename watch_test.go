@@ -0,0 +1,149 @@
+package labjack
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/gousb"
+)
+
+func device(bus, address int) gousb.DeviceDesc {
+	return gousb.DeviceDesc{Bus: bus, Address: address, Vendor: LabJackVendorID, Product: U6ProductID}
+}
+
+func devices(descs ...gousb.DeviceDesc) map[usbLocation]gousb.DeviceDesc {
+	present := make(map[usbLocation]gousb.DeviceDesc)
+	for _, desc := range descs {
+		present[usbLocation{desc.Bus, desc.Address}] = desc
+	}
+	return present
+}
+
+func Test_DiffDevices(t *testing.T) {
+	attached := map[usbLocation]DeviceEvent{
+		{1, 5}: {Type: DeviceAttached, Bus: 1, Address: 5, SerialNumber: "360000001"},
+		{1, 7}: {Type: DeviceAttached, Bus: 1, Address: 7, SerialNumber: "360000002"},
+	}
+
+	detached, added := diffDevices(attached, devices(device(1, 7), device(2, 3), device(1, 9)))
+	if len(detached) != 1 || detached[0].Type != DeviceDetached || detached[0].Address != 5 || detached[0].SerialNumber != "360000001" {
+		t.Errorf("Detached = %+v, expected 1/5", detached)
+	}
+	if len(added) != 2 || added[0].Bus != 1 || added[0].Address != 9 || added[1].Bus != 2 || added[1].Address != 3 {
+		t.Errorf("Added = %+v, expected 1/9 and 2/3", added)
+	}
+
+	detached, added = diffDevices(attached, devices(device(1, 5), device(1, 7)))
+	if len(detached) != 0 || len(added) != 0 {
+		t.Errorf("Unchanged devices reported %+v and %+v", detached, added)
+	}
+
+	detached, added = diffDevices(nil, nil)
+	if len(detached) != 0 || len(added) != 0 {
+		t.Errorf("No devices reported %+v and %+v", detached, added)
+	}
+}
+
+func Test_Watch(t *testing.T) {
+	scans := []map[usbLocation]gousb.DeviceDesc{
+		devices(device(1, 5)),
+		devices(device(1, 5), device(1, 7)),
+		devices(device(1, 7)),
+		devices(device(1, 7), device(1, 5)),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	scanned := make(chan struct{})
+	scan := func() (map[usbLocation]gousb.DeviceDesc, error) {
+		if len(scans) == 0 {
+			close(scanned)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		present := scans[0]
+		scans = scans[1:]
+		return present, nil
+	}
+	serial := func(loc usbLocation) string {
+		return map[int]string{5: "360000001", 7: "360000002"}[loc.address]
+	}
+
+	events := make(chan DeviceEvent)
+	go watch(ctx, time.Millisecond, scan, serial, events)
+
+	expected := []struct {
+		typ     DeviceEventType
+		address int
+		serial  string
+	}{
+		{DeviceAttached, 5, "360000001"},
+		{DeviceAttached, 7, "360000002"},
+		{DeviceDetached, 5, "360000001"},
+		{DeviceAttached, 5, "360000001"},
+	}
+	for i, exp := range expected {
+		select {
+		case event := <-events:
+			if event.Type != exp.typ || event.Bus != 1 || event.Address != exp.address || event.SerialNumber != exp.serial {
+				t.Errorf("Event %d = %+v, expected %v 1/%d %s", i, event, exp.typ, exp.address, exp.serial)
+			}
+			if event.Time.IsZero() {
+				t.Errorf("Event %d has no time", i)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for event %d", i)
+		}
+	}
+
+	select {
+	case <-scanned:
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for the last scan")
+	}
+	cancel()
+
+	select {
+	case event, ok := <-events:
+		if ok {
+			t.Errorf("Unexpected event %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Events were not closed after the context was done")
+	}
+}
+
+func Test_WatchCancelBlockedSend(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	scan := func() (map[usbLocation]gousb.DeviceDesc, error) {
+		return devices(device(1, 5), device(1, 7)), nil
+	}
+	serial := func(usbLocation) string { return "" }
+
+	events := make(chan DeviceEvent)
+	done := make(chan struct{})
+	go func() {
+		watch(ctx, time.Millisecond, scan, serial, events)
+		close(done)
+	}()
+
+	<-events
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Watch did not return after the context was done")
+	}
+	if _, ok := <-events; ok {
+		t.Error("Events were not closed")
+	}
+}
+
+func Test_WatchNilContext(t *testing.T) {
+	if _, err := Watch(context.Background(), nil, 0); err != ErrInvalidContext {
+		t.Errorf("Watch(nil) = %v, expected %v", err, ErrInvalidContext)
+	}
+}